@@ -0,0 +1,428 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command gozzle executes the requests of a JSON or YAML request set definition file and prints a summary per
+// request name.
+//
+// Usage:
+//
+//	gozzle [flags] <definition file>
+//	gozzle load [flags] <definition file>
+//
+// The load subcommand executes the requests repeatedly for a duration and prints throughput, status distribution,
+// errors and latency percentiles per request name.
+//
+// The exit code is 1 if any response has errors or doesn't meet its expectations and 2 if the definition can't be
+// loaded.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asticode/go-gozzle/gozzle"
+)
+
+// Exit codes
+const (
+	exitOK = iota
+	exitErrors
+	exitUsage
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type variables map[string]string
+
+// String implements the flag.Value interface
+func (v variables) String() string {
+	var ss []string
+	for k, val := range v {
+		ss = append(ss, k+"="+val)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+// Set implements the flag.Value interface
+func (v variables) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid variable %q, expected key=value", s)
+	}
+	v[kv[0]] = kv[1]
+	return nil
+}
+
+type options struct {
+	baseURL     string
+	concurrency int
+	json        bool
+	maxSizeBody int
+	path        string
+	timeout     time.Duration
+	vars        variables
+}
+
+func parseFlags(name string, args []string, stderr io.Writer, o *options, extra func(fs *flag.FlagSet)) (*flag.FlagSet, error) {
+	// Create flag set
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&o.baseURL, "base-url", "", "base URL prepended to relative request paths")
+	fs.IntVar(&o.concurrency, "concurrency", 0, "max number of requests sent at once, 0 means no limit")
+	fs.BoolVar(&o.json, "json", false, "print the results as JSON")
+	fs.IntVar(&o.maxSizeBody, "max-body", 0, "max size of response bodies in bytes, 0 means no limit")
+	fs.DurationVar(&o.timeout, "timeout", 0, "time limit of each request, 0 means no limit")
+	o.vars = make(variables)
+	fs.Var(o.vars, "var", "variable used in the definition as key=value, can be repeated")
+	if extra != nil {
+		extra(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [flags] <definition file>\n", name)
+		fs.PrintDefaults()
+	}
+
+	// Parse
+	if e := fs.Parse(args); e != nil {
+		return fs, e
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fs, flag.ErrHelp
+	}
+	o.path = fs.Arg(0)
+	return fs, nil
+}
+
+// load loads the definition and creates the gozzle and the request set, flags overriding the definition configuration
+func load(fs *flag.FlagSet, o options) (gozzle.Gozzle, gozzle.RequestSet, error) {
+	// Load definition
+	d, e := gozzle.LoadRequestSetDefinition(o.path, o.vars)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	// Create gozzle
+	var c gozzle.Configuration
+	if d.Configuration != nil {
+		c = *d.Configuration
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "concurrency":
+			c.Concurrency = o.concurrency
+		case "max-body":
+			c.MaxSizeBody = o.maxSizeBody
+		case "timeout":
+			c.Timeout = gozzle.Duration(o.timeout)
+		}
+	})
+	g := gozzle.NewGozzleFromConfiguration(c)
+
+	// Create request set
+	reqSet := d.RequestSet()
+	if o.baseURL != "" {
+		for _, name := range reqSet.Names() {
+			r := reqSet.GetRequest(name)
+			if !strings.Contains(r.Path(), "://") {
+				r.SetPath(strings.TrimRight(o.baseURL, "/") + "/" + strings.TrimLeft(r.Path(), "/"))
+			}
+		}
+	}
+
+	// Validate request set
+	if e = reqSet.Validate(); e != nil {
+		return nil, nil, e
+	}
+	return g, reqSet, nil
+}
+
+type result struct {
+	Errors       []string            `json:"errors"`
+	Expectations []expectationResult `json:"expectations"`
+	Latency      string              `json:"latency"`
+	LatencyMS    float64             `json:"latency_ms"`
+	Name         string              `json:"name"`
+	Size         int                 `json:"size"`
+	SkipReason   string              `json:"skip_reason,omitempty"`
+	State        string              `json:"state"`
+	Status       string              `json:"status"`
+	StatusCode   int                 `json:"status_code"`
+}
+
+type expectationResult struct {
+	Error       string `json:"error,omitempty"`
+	Expectation string `json:"expectation"`
+	Passed      bool   `json:"passed"`
+}
+
+// checks formats the expectation results such as "2/3"
+func (r result) checks() string {
+	if len(r.Expectations) == 0 {
+		return "-"
+	}
+	var n int
+	for _, e := range r.Expectations {
+		if e.Passed {
+			n++
+		}
+	}
+	return fmt.Sprintf("%d/%d", n, len(r.Expectations))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	// Subcommands
+	if len(args) > 0 && args[0] == "load" {
+		return runLoad(args[1:], stdout, stderr)
+	}
+
+	// Parse flags
+	var o options
+	fs, e := parseFlags("gozzle", args, stderr, &o, nil)
+	if e != nil {
+		return exitUsage
+	}
+
+	// Load
+	g, reqSet, e := load(fs, o)
+	if e != nil {
+		fmt.Fprintln(stderr, e)
+		return exitUsage
+	}
+
+	// Execute requests
+	respSet := g.Exec(reqSet)
+	defer respSet.Close()
+
+	// Build results in the definition order
+	names := respSet.Names()
+	var rs []result
+	code := exitOK
+	for _, name := range names {
+		// Read body
+		resp := respSet.GetResponse(name)
+		b, err := resp.Body()
+
+		// Create result
+		r := result{
+			Errors:       []string{},
+			Expectations: []expectationResult{},
+			Latency:      resp.Timing().Duration.String(),
+			LatencyMS:    milliseconds(resp.Timing().Duration),
+			Name:         name,
+			Size:         len(b),
+			SkipReason:   resp.SkipReason(),
+			State:        resp.State(),
+			Status:       resp.Status(),
+			StatusCode:   resp.StatusCode(),
+		}
+		for _, err := range resp.Errors() {
+			r.Errors = append(r.Errors, err.Error())
+		}
+		if err != nil && len(r.Errors) == 0 {
+			r.Errors = append(r.Errors, err.Error())
+		}
+		if len(r.Errors) > 0 {
+			code = exitErrors
+		}
+
+		// Add expectations
+		for _, v := range resp.Expectations() {
+			er := expectationResult{Expectation: v.Expectation, Passed: v.Passed()}
+			if !v.Passed() {
+				er.Error = v.Error.Error()
+				code = exitErrors
+			}
+			r.Expectations = append(r.Expectations, er)
+		}
+		rs = append(rs, r)
+	}
+
+	// Print results
+	if o.json {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if e = enc.Encode(rs); e != nil {
+			fmt.Fprintln(stderr, e)
+		}
+		return code
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tSTATUS\tLATENCY\tSIZE\tCHECKS\tERRORS")
+	for _, r := range rs {
+		errs := strings.Join(r.Errors, "; ")
+		if r.SkipReason != "" {
+			errs = r.SkipReason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\n", r.Name, r.State, r.StatusCode, r.Latency, r.Size, r.checks(), errs)
+	}
+	w.Flush()
+
+	// Print failed expectations
+	if report := respSet.Report(); !report.Passed() {
+		fmt.Fprintf(stdout, "\nFailed expectations:\n%s\n", report.Failures())
+	}
+	return code
+}
+
+type loadResult struct {
+	Count       int            `json:"count"`
+	Errors      map[string]int `json:"errors"`
+	LatencyMS   loadLatencies  `json:"latency_ms"`
+	Name        string         `json:"name"`
+	Statuses    map[int]int    `json:"statuses"`
+	Throughput  float64        `json:"throughput"`
+	errorsCount int
+}
+
+type loadLatencies struct {
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99.9"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func runLoad(args []string, stdout, stderr io.Writer) int {
+	// Parse flags
+	var o options
+	var duration time.Duration
+	var rate float64
+	var workers int
+	fs, e := parseFlags("gozzle load", args, stderr, &o, func(fs *flag.FlagSet) {
+		fs.DurationVar(&duration, "duration", 10*time.Second, "how long the requests are executed")
+		fs.Float64Var(&rate, "rate", 0, "number of request set executions started per second, 0 means no limit")
+		fs.IntVar(&workers, "workers", 1, "number of request set executions running at once")
+	})
+	if e != nil {
+		return exitUsage
+	}
+
+	// Load
+	g, reqSet, e := load(fs, o)
+	if e != nil {
+		fmt.Fprintln(stderr, e)
+		return exitUsage
+	}
+
+	// Create load generator
+	l := gozzle.NewLoadGenerator(g, reqSet).SetConcurrency(workers).SetDuration(duration).SetRate(rate)
+
+	// Stop on interrupt
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	defer signal.Stop(ch)
+	go func() {
+		if _, ok := <-ch; ok {
+			l.Stop()
+		}
+	}()
+
+	// Run
+	r, e := l.Run()
+	if e != nil {
+		fmt.Fprintln(stderr, e)
+		return exitUsage
+	}
+
+	// Build results in the definition order
+	names := reqSet.Names()
+	var rs []loadResult
+	code := exitOK
+	for _, name := range names {
+		s := r.Requests[name]
+		lr := loadResult{
+			Count:  s.Count,
+			Errors: s.Errors,
+			LatencyMS: loadLatencies{
+				Max:  milliseconds(s.Latency.Max()),
+				Mean: milliseconds(s.Latency.Mean()),
+				Min:  milliseconds(s.Latency.Min()),
+				P50:  milliseconds(s.Latency.Percentile(50)),
+				P90:  milliseconds(s.Latency.Percentile(90)),
+				P99:  milliseconds(s.Latency.Percentile(99)),
+				P999: milliseconds(s.Latency.Percentile(99.9)),
+			},
+			Name:       name,
+			Statuses:   s.Statuses,
+			Throughput: s.Throughput,
+		}
+		for _, c := range s.Errors {
+			lr.errorsCount += c
+		}
+		if lr.errorsCount > 0 {
+			code = exitErrors
+		}
+		rs = append(rs, lr)
+	}
+
+	// Print results
+	if o.json {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if e = enc.Encode(rs); e != nil {
+			fmt.Fprintln(stderr, e)
+		}
+		return code
+	}
+	fmt.Fprintf(stdout, "Duration: %s, iterations: %d\n\n", r.Duration.Round(time.Millisecond), r.Iterations)
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREQUESTS\tRPS\tP50\tP90\tP99\tP99.9\tMAX\tSTATUSES\tERRORS")
+	for _, lr := range rs {
+		s := r.Requests[lr.Name]
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", lr.Name, lr.Count, lr.Throughput,
+			s.Latency.Percentile(50), s.Latency.Percentile(90), s.Latency.Percentile(99), s.Latency.Percentile(99.9),
+			s.Latency.Max(), formatStatuses(lr.Statuses), lr.errorsCount)
+	}
+	w.Flush()
+
+	// Print errors
+	if code == exitErrors {
+		fmt.Fprintln(stdout, "\nErrors:")
+		w = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, lr := range rs {
+			var msgs []string
+			for m := range lr.Errors {
+				msgs = append(msgs, m)
+			}
+			sort.Strings(msgs)
+			for _, m := range msgs {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", lr.Name, lr.Errors[m], m)
+			}
+		}
+		w.Flush()
+	}
+	return code
+}
+
+// formatStatuses formats a status distribution such as "200:10 500:2"
+func formatStatuses(m map[int]int) string {
+	var cs []int
+	for c := range m {
+		cs = append(cs, c)
+	}
+	sort.Ints(cs)
+	var ss []string
+	for _, c := range cs {
+		ss = append(ss, fmt.Sprintf("%d:%d", c, m[c]))
+	}
+	return strings.Join(ss, " ")
+}
@@ -0,0 +1,177 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeDefinition(t *testing.T, content string) string {
+	p := filepath.Join(t.TempDir(), "definition.yml")
+	assert.NoError(t, ioutil.WriteFile(p, []byte(content), 0600))
+	return p
+}
+
+func TestRun(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(r.URL.Query().Get("v")))
+	}))
+	defer s.Close()
+	p := writeDefinition(t, `requests:
+  - name: ok
+    path: ${BASE}/ok
+    query:
+      v: test
+  - name: relative
+    path: /ok
+`)
+	var stdout, stderr bytes.Buffer
+
+	// Assert table
+	c := run([]string{"-var", "BASE=" + s.URL, "-base-url", s.URL, p}, &stdout, &stderr)
+	assert.Equal(t, exitOK, c, stderr.String())
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, []string{"NAME", "STATE", "STATUS", "LATENCY", "SIZE", "CHECKS", "ERRORS"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"ok", "sent", "200"}, strings.Fields(lines[1])[:3])
+	assert.Equal(t, "4", strings.Fields(lines[1])[4])
+	assert.Equal(t, []string{"relative", "sent", "200"}, strings.Fields(lines[2])[:3])
+	assert.Equal(t, "0", strings.Fields(lines[2])[4])
+
+	// Assert JSON and errors
+	p = writeDefinition(t, `configuration:
+  timeout: 1s
+requests:
+  - name: missing
+    path: `+s.URL+`/missing
+`)
+	stdout.Reset()
+	c = run([]string{"-json", "-concurrency", "1", p}, &stdout, &stderr)
+	assert.Equal(t, exitErrors, c)
+	var rs []result
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &rs))
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "missing", rs[0].Name)
+	assert.Equal(t, "sent", rs[0].State)
+	assert.Equal(t, http.StatusNotFound, rs[0].StatusCode)
+	assert.Equal(t, []string{"Invalid status code 404 Not Found"}, rs[0].Errors)
+}
+
+func TestRunExpectations(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer s.Close()
+	p := writeDefinition(t, `requests:
+  - name: test
+    path: `+s.URL+`
+    expect:
+      status: [404]
+      json:
+        $.id: 2
+      max_latency: 1m
+`)
+	var stdout, stderr bytes.Buffer
+
+	// Assert table
+	c := run([]string{p}, &stdout, &stderr)
+	assert.Equal(t, exitErrors, c)
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, "2/3", strings.Fields(lines[1])[5])
+	assert.Equal(t, "Failed expectations:", lines[3])
+	assert.Equal(t, "FAIL test: $.id == 2: got 1", lines[4])
+
+	// Assert JSON
+	stdout.Reset()
+	c = run([]string{"-json", p}, &stdout, &stderr)
+	assert.Equal(t, exitErrors, c)
+	var rs []result
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &rs))
+	assert.Empty(t, rs[0].Errors)
+	assert.Equal(t, []expectationResult{
+		{Expectation: "status in [404]", Passed: true},
+		{Error: "got 1", Expectation: "$.id == 2"},
+		{Expectation: "latency <= 1m0s", Passed: true},
+	}, rs[0].Expectations)
+}
+
+func TestRunUsage(t *testing.T) {
+	// Initialize
+	var stdout, stderr bytes.Buffer
+
+	// Assert
+	assert.Equal(t, exitUsage, run([]string{}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: gozzle [flags] <definition file>")
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{"-var", "invalid", "test.yml"}, &stdout, &stderr))
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{writeDefinition(t, "requests: test")}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "line 1: requests must be an array")
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{writeDefinition(t, "requests:\n  - name: test\n    path: /test")}, &stdout, &stderr))
+	assert.Equal(t, "test: Invalid URL: unsupported scheme \"\"\n", stderr.String())
+}
+
+func TestRunLoad(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+	p := writeDefinition(t, `requests:
+  - name: ok
+    path: /ok
+  - name: error
+    path: /error
+`)
+	var stdout, stderr bytes.Buffer
+
+	// Assert table
+	c := run([]string{"load", "-duration", "50ms", "-workers", "2", "-base-url", s.URL, p}, &stdout, &stderr)
+	assert.Equal(t, exitErrors, c, stderr.String())
+	o := stdout.String()
+	assert.Contains(t, o, "NAME")
+	assert.Contains(t, o, "P99.9")
+	assert.Contains(t, o, "Errors:")
+	assert.Contains(t, o, "Invalid status code 500 Internal Server Error")
+
+	// Assert JSON
+	stdout.Reset()
+	c = run([]string{"load", "-json", "-duration", "50ms", "-rate", "100", "-base-url", s.URL, p}, &stdout, &stderr)
+	assert.Equal(t, exitErrors, c)
+	var rs []loadResult
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &rs))
+	assert.Len(t, rs, 2)
+	assert.Equal(t, "ok", rs[0].Name)
+	assert.Equal(t, map[int]int{http.StatusOK: rs[0].Count}, rs[0].Statuses)
+	assert.Empty(t, rs[0].Errors)
+	assert.True(t, rs[0].Count > 0)
+	assert.True(t, rs[0].LatencyMS.Max >= rs[0].LatencyMS.P50)
+	assert.Equal(t, "error", rs[1].Name)
+	assert.Equal(t, map[int]int{http.StatusInternalServerError: rs[1].Count}, rs[1].Statuses)
+
+	// Invalid rate
+	stderr.Reset()
+	assert.Equal(t, exitUsage, run([]string{"load", "-rate", "2e9", "-base-url", s.URL, p}, &stdout, &stderr))
+	assert.Equal(t, "Invalid rate 2e+09\n", stderr.String())
+}
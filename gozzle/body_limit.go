@@ -0,0 +1,154 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Body limit modes
+const (
+	// The body is truncated after the max size and ErrBodyTooLarge is added to the response errors once detected
+	BodyLimitTruncate string = "truncate"
+	// Reading the body past the max size returns ErrBodyTooLarge which is also added to the response errors
+	BodyLimitFail string = "fail"
+	// The body is read when the response is created and, if it's too large, discarded and replaced with an empty body
+	// while ErrBodyTooLarge is added to the response errors. Streaming bodies (server-sent events, NDJSON, etc.) are
+	// handled as with BodyLimitFail instead.
+	BodyLimitDiscard string = "discard"
+)
+
+// Variables
+var (
+	ErrBodyTooLarge = errors.New("Body too large")
+)
+
+// responseOptions returns the options used to create the response of a request
+func (g gozzle) responseOptions(req Request) (o responseOptions) {
+	// Max size body
+	o.maxSizeBody = g.maxSizeBody
+	if req.MaxSizeBody() != 0 {
+		o.maxSizeBody = req.MaxSizeBody()
+	}
+
+	// Body limit mode
+	o.bodyLimitMode = g.bodyLimitMode
+	if req.BodyLimitMode() != "" {
+		o.bodyLimitMode = req.BodyLimitMode()
+	}
+
+	// Decompression
+	o.decompress = g.decompression
+
+	// Success policy
+	o.successPolicy = g.requestSuccessPolicy(req)
+	return
+}
+
+// limitBody limits the size of the response body
+func (r *response) limitBody(max int64, mode string) {
+	// Nothing to limit
+	// HEAD responses keep the Content-Length header of the body they don't have
+	or := r.originalResponse
+	if or.Body == nil || or.Body == http.NoBody || (or.Request != nil && or.Request.Method == MethodHead) {
+		return
+	}
+
+	// Content length is already known to be too large
+	if or.ContentLength > max {
+		r.addError(ErrBodyTooLarge)
+		if mode == BodyLimitDiscard {
+			or.Body.Close()
+			or.Body = ioutil.NopCloser(bytes.NewReader([]byte{}))
+			return
+		}
+	}
+
+	// Streaming bodies can't be read beforehand
+	if mode == BodyLimitDiscard && isStreaming(or) {
+		mode = BodyLimitFail
+	}
+
+	// Discard
+	if mode == BodyLimitDiscard {
+		// Read body
+		b, e := ioutil.ReadAll(io.LimitReader(or.Body, max+1))
+		if e != nil {
+			r.addError(e)
+		}
+
+		// Body is too large
+		if int64(len(b)) > max {
+			or.Body.Close()
+			r.addError(ErrBodyTooLarge)
+			b = []byte{}
+		}
+
+		// Update body
+		or.Body = struct {
+			io.Reader
+			io.Closer
+		}{bytes.NewReader(b), or.Body}
+		return
+	}
+
+	// Limit body
+	or.Body = &limitReadCloser{
+		fail: mode == BodyLimitFail,
+		n:    max,
+		r:    r,
+		rc:   or.Body,
+	}
+}
+
+type limitReadCloser struct {
+	exceeded bool
+	fail     bool
+	n        int64
+	r        *response
+	rc       io.ReadCloser
+}
+
+// Read implements the io.Reader interface
+func (l *limitReadCloser) Read(p []byte) (n int, e error) {
+	// Limit has already been exceeded
+	if l.exceeded {
+		return 0, l.eof()
+	}
+
+	// Limit has been reached, check whether there's more data
+	if l.n <= 0 {
+		var b [1]byte
+		if n, _ = io.ReadFull(l.rc, b[:]); n > 0 {
+			l.exceeded = true
+			l.r.addErrorOnce(ErrBodyTooLarge)
+		}
+		return 0, l.eof()
+	}
+
+	// Read
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, e = l.rc.Read(p)
+	l.n -= int64(n)
+	return
+}
+
+func (l *limitReadCloser) eof() error {
+	if l.exceeded && l.fail {
+		return ErrBodyTooLarge
+	}
+	return io.EOF
+}
+
+// Close implements the io.Closer interface
+func (l *limitReadCloser) Close() error {
+	return l.rc.Close()
+}
@@ -0,0 +1,133 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newLimitedResponse(b string, contentLength int64, max int, mode string) *response {
+	return newResponse(&http.Response{
+		Body:          mockedIoReaderCloser([]byte(b)),
+		ContentLength: contentLength,
+		StatusCode:    200,
+	}, responseOptions{bodyLimitMode: mode, maxSizeBody: max, successPolicy: DefaultSuccessPolicy})
+}
+
+func TestBodyLimitTruncate(t *testing.T) {
+	// Body is not too large
+	r := newLimitedResponse("test", -1, 4, BodyLimitTruncate)
+	b, e := r.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+	assert.Len(t, r.Errors(), 0)
+
+	// Body is too large
+	r = newLimitedResponse("testmessage", -1, 4, BodyLimitTruncate)
+	assert.Len(t, r.Errors(), 0)
+	b, e = r.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+	assert.Equal(t, []error{ErrBodyTooLarge}, r.Errors())
+
+	// Content length is too large
+	r = newLimitedResponse("testmessage", 11, 4, BodyLimitTruncate)
+	assert.Equal(t, []error{ErrBodyTooLarge}, r.Errors())
+	b, e = r.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+	assert.Equal(t, []error{ErrBodyTooLarge}, r.Errors())
+}
+
+func TestBodyLimitFail(t *testing.T) {
+	// Body is too large
+	r := newLimitedResponse("testmessage", -1, 4, BodyLimitFail)
+	_, e := r.Body()
+	assert.Equal(t, ErrBodyTooLarge, e)
+	assert.Equal(t, []error{ErrBodyTooLarge}, r.Errors())
+
+	// Body is not too large
+	r = newLimitedResponse("test", -1, 4, BodyLimitFail)
+	b, e := ioutil.ReadAll(r.BodyReader())
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+}
+
+func TestBodyLimitDiscard(t *testing.T) {
+	// Body is too large
+	r := newLimitedResponse("testmessage", -1, 4, BodyLimitDiscard)
+	assert.Equal(t, []error{ErrBodyTooLarge}, r.Errors())
+	b, e := r.Body()
+	assert.NoError(t, e)
+	assert.Empty(t, b)
+
+	// Body is not too large
+	r = newLimitedResponse("test", -1, 4, BodyLimitDiscard)
+	assert.Len(t, r.Errors(), 0)
+	b, e = r.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+}
+
+func TestBodyLimitHead(t *testing.T) {
+	for _, mode := range []string{BodyLimitTruncate, BodyLimitFail, BodyLimitDiscard} {
+		// No body
+		r := newResponse(&http.Response{
+			Body:          http.NoBody,
+			ContentLength: 1000,
+			StatusCode:    200,
+		}, responseOptions{bodyLimitMode: mode, maxSizeBody: 10, successPolicy: DefaultSuccessPolicy})
+		assert.Len(t, r.Errors(), 0, mode)
+
+		// HEAD request
+		httpReq, _ := http.NewRequest(MethodHead, "http://localhost", nil)
+		r = newResponse(&http.Response{
+			Body:          mockedIoReaderCloser([]byte{}),
+			ContentLength: 1000,
+			Request:       httpReq,
+			StatusCode:    200,
+		}, responseOptions{bodyLimitMode: mode, maxSizeBody: 10, successPolicy: DefaultSuccessPolicy})
+		assert.Len(t, r.Errors(), 0, mode)
+		b, e := r.Body()
+		assert.NoError(t, e, mode)
+		assert.Empty(t, b, mode)
+	}
+}
+
+func TestExecBodyLimit(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "11")
+		w.Write([]byte("testmessage"))
+	}))
+	defer server.Close()
+
+	// Create request set
+	reqSet := NewRequestSet().
+		AddRequest(NewRequest("gozzle", MethodGet, server.URL)).
+		AddRequest(NewRequest("request", MethodGet, server.URL).SetMaxSizeBody(-1)).
+		AddRequest(NewRequest("mode", MethodGet, server.URL).SetBodyLimitMode(BodyLimitFail)).
+		AddRequest(NewRequest("head", MethodHead, server.URL))
+
+	// Execute requests
+	respSet := NewGozzleFromConfiguration(Configuration{MaxSizeBody: 4, BodyLimitMode: BodyLimitDiscard}).Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.Equal(t, []error{ErrBodyTooLarge}, respSet.GetResponse("gozzle").Errors())
+	b, e := respSet.GetResponse("request").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "testmessage", string(b))
+	assert.Equal(t, []error{ErrBodyTooLarge}, respSet.GetResponse("mode").Errors())
+	_, e = respSet.GetResponse("mode").Body()
+	assert.Equal(t, ErrBodyTooLarge, e)
+	assert.Empty(t, respSet.GetResponse("head").Errors())
+	assert.Equal(t, http.StatusOK, respSet.GetResponse("head").StatusCode())
+}
@@ -0,0 +1,216 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	CircuitBreakerKeyHost string = "host"
+	CircuitBreakerKeyName string = "name"
+)
+
+// Variables
+var (
+	ErrCircuitOpen = errors.New("Circuit open")
+)
+
+// CircuitState represents the state of a circuit
+type CircuitState int
+
+// Circuit states
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String implements the fmt.Stringer interface
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfiguration represents a JSON-friendly circuit breaker configuration
+//
+// Key is either "host" (default) or "name" and defines whether circuits are tracked per request host or per request
+// name. Requests sent through Unix domain sockets are tracked per socket path.
+// FailureThreshold is the number of consecutive failures opening a circuit. A value <= 0 disables the circuit breaker.
+// A failure is either a transport error or a 5xx status code.
+// CoolDown is the time an open circuit waits before letting a probe request through (half-open state).
+// SuccessThreshold is the number of consecutive successful probes closing a half-open circuit. Default is 1.
+type CircuitBreakerConfiguration struct {
+	Key              string   `json:"key"`
+	FailureThreshold int      `json:"failure_threshold"`
+	SuccessThreshold int      `json:"success_threshold"`
+	CoolDown         Duration `json:"cool_down"`
+}
+
+// CircuitBreakerHandler represents a function executed each time a circuit changes state
+type CircuitBreakerHandler func(key string, from, to CircuitState)
+
+type circuitBreaker struct {
+	circuits map[string]*circuit
+	config   CircuitBreakerConfiguration
+	handler  CircuitBreakerHandler
+	mutex    sync.Mutex
+}
+
+type circuit struct {
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	state     CircuitState
+	successes int
+}
+
+func newCircuitBreaker(c CircuitBreakerConfiguration, h CircuitBreakerHandler) *circuitBreaker {
+	// Disabled
+	if c.FailureThreshold <= 0 {
+		return nil
+	}
+
+	// Default values
+	if c.SuccessThreshold <= 0 {
+		c.SuccessThreshold = 1
+	}
+	return &circuitBreaker{
+		circuits: make(map[string]*circuit),
+		config:   c,
+		handler:  h,
+	}
+}
+
+func (b *circuitBreaker) key(req Request, httpReq *http.Request) string {
+	if b == nil {
+		return ""
+	} else if b.config.Key == CircuitBreakerKeyName {
+		return req.Name()
+	}
+	return requestHost(httpReq)
+}
+
+// allow returns ErrCircuitOpen if the request must not be sent
+func (b *circuitBreaker) allow(key string) (e error) {
+	// Disabled
+	if b == nil {
+		return
+	}
+
+	// Lock
+	b.mutex.Lock()
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	// Switch on state
+	from := c.state
+	switch c.state {
+	case CircuitOpen:
+		if time.Since(c.openedAt) < time.Duration(b.config.CoolDown) {
+			e = ErrCircuitOpen
+		} else {
+			c.state = CircuitHalfOpen
+			c.probing = true
+			c.successes = 0
+		}
+	case CircuitHalfOpen:
+		if c.probing {
+			e = ErrCircuitOpen
+		} else {
+			c.probing = true
+		}
+	}
+	to := c.state
+	b.mutex.Unlock()
+
+	// Handle state change
+	b.handle(key, from, to)
+	return
+}
+
+// record records the result of a request that has been allowed
+func (b *circuitBreaker) record(key string, failure bool) {
+	// Disabled
+	if b == nil {
+		return
+	}
+
+	// Lock
+	b.mutex.Lock()
+	c, ok := b.circuits[key]
+	if !ok {
+		b.mutex.Unlock()
+		return
+	}
+
+	// Switch on state
+	from := c.state
+	switch c.state {
+	case CircuitClosed:
+		if !failure {
+			c.failures = 0
+		} else if c.failures++; c.failures >= b.config.FailureThreshold {
+			c.open()
+		}
+	case CircuitHalfOpen:
+		c.probing = false
+		if failure {
+			c.open()
+		} else if c.successes++; c.successes >= b.config.SuccessThreshold {
+			c.state = CircuitClosed
+			c.failures = 0
+		}
+	}
+	to := c.state
+	b.mutex.Unlock()
+
+	// Handle state change
+	b.handle(key, from, to)
+}
+
+// release releases the circuit of a request that has been allowed but not sent so that another request can probe it
+func (b *circuitBreaker) release(key string) {
+	// Disabled
+	if b == nil {
+		return
+	}
+
+	// Lock
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Release probe
+	if c, ok := b.circuits[key]; ok && c.state == CircuitHalfOpen {
+		c.probing = false
+	}
+}
+
+func (b *circuitBreaker) handle(key string, from, to CircuitState) {
+	if from != to && b.handler != nil {
+		b.handler(key, from, to)
+	}
+}
+
+func (c *circuit) open() {
+	c.state = CircuitOpen
+	c.openedAt = time.Now()
+	c.failures = 0
+	c.successes = 0
+}
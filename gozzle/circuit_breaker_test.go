@@ -0,0 +1,117 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// Initialize
+	var states []CircuitState
+	b := newCircuitBreaker(CircuitBreakerConfiguration{
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		CoolDown:         Duration(20 * time.Millisecond),
+	}, func(key string, from, to CircuitState) {
+		assert.Equal(t, "test", key)
+		states = append(states, to)
+	})
+
+	// Closed
+	assert.NoError(t, b.allow("test"))
+	b.record("test", true)
+	assert.NoError(t, b.allow("test"))
+	b.record("test", false)
+	assert.NoError(t, b.allow("test"))
+	b.record("test", true)
+	assert.NoError(t, b.allow("test"))
+	b.record("test", true)
+
+	// Open
+	assert.Equal(t, ErrCircuitOpen, b.allow("test"))
+	assert.NoError(t, b.allow("other"))
+
+	// Half open
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, b.allow("test"))
+	assert.Equal(t, ErrCircuitOpen, b.allow("test"))
+	b.record("test", true)
+	assert.Equal(t, ErrCircuitOpen, b.allow("test"))
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, b.allow("test"))
+	b.release("test")
+	assert.NoError(t, b.allow("test"))
+	b.record("test", false)
+
+	// Closed
+	assert.NoError(t, b.allow("test"))
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, states)
+
+	// Disabled
+	assert.Nil(t, newCircuitBreaker(CircuitBreakerConfiguration{}, nil))
+}
+
+func TestExecCircuitBreaker(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Create gozzle
+	var opened bool
+	g := NewGozzleFromConfiguration(Configuration{CircuitBreaker: CircuitBreakerConfiguration{
+		FailureThreshold: 1,
+		CoolDown:         Duration(time.Minute),
+	}}).SetCircuitBreakerHandler(func(key string, from, to CircuitState) {
+		opened = to == CircuitOpen
+	})
+
+	// Create request set
+	reqSet := NewRequestSet().AddRequest(NewRequest("test", MethodGet, server.URL))
+
+	// Execute requests
+	respSet := g.Exec(reqSet)
+	respSet.Close()
+	assert.True(t, opened)
+	assert.Equal(t, http.StatusServiceUnavailable, respSet.GetResponse("test").StatusCode())
+	respSet = g.Exec(reqSet)
+
+	// Assert
+	assert.Len(t, respSet.GetResponse("test").Errors(), 1)
+	assert.Equal(t, ErrCircuitOpen, respSet.GetResponse("test").Errors()[0])
+}
+
+func TestExecCircuitBreakerRateLimit(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Create gozzle
+	g := NewGozzleFromConfiguration(Configuration{
+		CircuitBreaker: CircuitBreakerConfiguration{FailureThreshold: 1, CoolDown: Duration(time.Minute)},
+		RateLimit:      RateLimitConfiguration{Global: RateLimit{Rate: 1, Burst: 1}},
+	})
+	reqSet := NewRequestSet().AddRequest(NewRequest("test", MethodGet, server.URL))
+	g.Exec(reqSet).Close()
+
+	// Rejected requests don't wait for the rate limiter
+	s := time.Now()
+	for i := 0; i < 3; i++ {
+		resp := g.Exec(reqSet).GetResponse("test")
+		assert.Len(t, resp.Errors(), 1)
+		assert.Equal(t, ErrCircuitOpen, resp.Errors()[0])
+		assert.Equal(t, time.Duration(0), resp.Timing().QueueWait)
+	}
+	assert.True(t, time.Since(s) < 500*time.Millisecond)
+}
@@ -0,0 +1,97 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Variables
+var (
+	ErrUnsupportedCompression = errors.New("Unsupported compression algorithm")
+)
+
+// Compression represents a JSON-friendly request body compression configuration
+// Algorithm is either EncodingGzip or EncodingZstd. Bodies smaller than Threshold bytes are sent uncompressed.
+type Compression struct {
+	Algorithm string `json:"algorithm"`
+	Threshold int    `json:"threshold"`
+}
+
+// requestCompression returns the request compression, falling back on the gozzle one
+func (g gozzle) requestCompression(req Request) *Compression {
+	if req.Compression() != nil {
+		return req.Compression()
+	}
+	return g.compression
+}
+
+// compressBody compresses the body and returns the content encoding to advertise, if any
+// The body is compressed on the fly and is never buffered entirely
+func compressBody(rc io.ReadCloser, c *Compression) (io.ReadCloser, string, error) {
+	// Check algorithm
+	switch c.Algorithm {
+	case EncodingGzip, EncodingZstd:
+	default:
+		return rc, "", ErrUnsupportedCompression
+	}
+
+	// Read the beginning of the body to check the threshold
+	var b []byte
+	if c.Threshold > 0 {
+		b = make([]byte, c.Threshold)
+		n, e := io.ReadFull(rc, b)
+		b = b[:n]
+		if e == io.EOF || e == io.ErrUnexpectedEOF {
+			// Body is too small
+			return struct {
+				io.Reader
+				io.Closer
+			}{bytes.NewReader(b), rc}, "", nil
+		} else if e != nil {
+			return rc, "", e
+		}
+	}
+
+	// Compress in a goroutine
+	pr, pw := io.Pipe()
+	go func() {
+		// Create writer
+		var w io.WriteCloser
+		if c.Algorithm == EncodingZstd {
+			var e error
+			if w, e = zstd.NewWriter(pw, zstd.WithEncoderConcurrency(1)); e != nil {
+				pw.CloseWithError(e)
+				return
+			}
+		} else {
+			w = gzip.NewWriter(pw)
+		}
+
+		// Copy
+		_, e := io.Copy(w, io.MultiReader(bytes.NewReader(b), rc))
+		if err := w.Close(); e == nil {
+			e = err
+		}
+		pw.CloseWithError(e)
+	}()
+	return &compressReadCloser{PipeReader: pr, rc: rc}, c.Algorithm, nil
+}
+
+type compressReadCloser struct {
+	*io.PipeReader
+	rc io.ReadCloser
+}
+
+// Close implements the io.Closer interface
+func (c *compressReadCloser) Close() error {
+	c.PipeReader.Close()
+	return c.rc.Close()
+}
@@ -0,0 +1,105 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressBody(t *testing.T) {
+	// Initialize
+	m := []byte("testmessage")
+
+	// Below threshold
+	rc, encoding, e := compressBody(ioutil.NopCloser(bytes.NewReader(m)), &Compression{Algorithm: EncodingGzip, Threshold: 20})
+	assert.NoError(t, e)
+	assert.Empty(t, encoding)
+	b, e := ioutil.ReadAll(rc)
+	assert.NoError(t, e)
+	assert.Equal(t, m, b)
+
+	// Gzip
+	rc, encoding, e = compressBody(ioutil.NopCloser(bytes.NewReader(m)), &Compression{Algorithm: EncodingGzip, Threshold: 4})
+	assert.NoError(t, e)
+	assert.Equal(t, EncodingGzip, encoding)
+	gr, e := gzip.NewReader(rc)
+	assert.NoError(t, e)
+	b, e = ioutil.ReadAll(gr)
+	assert.NoError(t, e)
+	assert.Equal(t, m, b)
+
+	// Zstd
+	rc, encoding, e = compressBody(ioutil.NopCloser(bytes.NewReader(m)), &Compression{Algorithm: EncodingZstd})
+	assert.NoError(t, e)
+	assert.Equal(t, EncodingZstd, encoding)
+	zr, e := zstd.NewReader(rc)
+	assert.NoError(t, e)
+	defer zr.Close()
+	b, e = ioutil.ReadAll(zr)
+	assert.NoError(t, e)
+	assert.Equal(t, m, b)
+
+	// Unsupported
+	_, _, e = compressBody(ioutil.NopCloser(bytes.NewReader(m)), &Compression{Algorithm: "test"})
+	assert.Equal(t, ErrUnsupportedCompression, e)
+}
+
+func TestExecCompression(t *testing.T) {
+	// Initialize
+	n := 10 << 20
+
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Get reader
+		var rd io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == EncodingGzip {
+			gr, e := gzip.NewReader(r.Body)
+			assert.NoError(t, e)
+			rd = gr
+		}
+
+		// Read
+		c, e := io.Copy(ioutil.Discard, rd)
+		assert.NoError(t, e)
+		w.Header().Set("X-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("X-Size", strconv.FormatInt(c, 10))
+	}))
+	defer server.Close()
+
+	// Create request set
+	reqSet := NewRequestSet().
+		AddRequest(NewRequest("reader", MethodPost, server.URL).SetBodyReader(io.LimitReader(zeroReader{}, int64(n)))).
+		AddRequest(NewRequest("small", MethodPost, server.URL).SetBody("test")).
+		AddRequest(NewRequest("none", MethodGet, server.URL))
+
+	// Execute requests
+	respSet := NewGozzle().SetCompression(&Compression{Algorithm: EncodingGzip, Threshold: 10}).Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.Equal(t, EncodingGzip, respSet.GetResponse("reader").Header().Get("X-Encoding"))
+	assert.Equal(t, strconv.Itoa(n), respSet.GetResponse("reader").Header().Get("X-Size"))
+	assert.Empty(t, respSet.GetResponse("small").Header().Get("X-Encoding"))
+	assert.Empty(t, respSet.GetResponse("none").Header().Get("X-Encoding"))
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
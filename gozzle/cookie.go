@@ -0,0 +1,286 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Variables
+var (
+	ErrInvalidCookieConfiguration = errors.New("Invalid cookie configuration")
+)
+
+// CookieConfiguration represents a JSON-friendly cookie jar configuration
+// Cookies are stored in memory unless File is set, in which case they're persisted in it. When Isolated is true, each
+// executed request set gets its own jar unless it has been given one. File and Isolated can't be combined since the
+// file would never be used. If the configuration is invalid or the file can't be loaded, requests fail with the error
+// until a jar is set.
+type CookieConfiguration struct {
+	File     string `json:"file"`
+	Isolated bool   `json:"isolated"`
+}
+
+// NewMemoryCookieJar creates a new in-memory cookie jar
+// Public suffix rules prevent hosts from setting cookies for domains such as "co.uk".
+func NewMemoryCookieJar() (http.CookieJar, error) {
+	return cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+}
+
+// FileCookieJar represents an in-memory cookie jar persisted in a file
+// Cookies are loaded from the file when the jar is created and saved each time they change. Err returns the error of
+// the last save, if any, and Save can be used to retry it.
+type FileCookieJar interface {
+	http.CookieJar
+	Err() error
+	Path() string
+	Save() error
+}
+
+type fileCookieJar struct {
+	cookies map[string]fileCookie
+	err     error
+	jar     http.CookieJar
+	mutex   sync.Mutex
+	path    string
+}
+
+// fileCookie represents a cookie persisted in a file along with the URL it was set for
+type fileCookie struct {
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HttpOnly bool       `json:"http_only,omitempty"`
+	Name     string     `json:"name"`
+	Path     string     `json:"path,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+	URL      string     `json:"url"`
+	Value    string     `json:"value"`
+}
+
+// NewFileCookieJar creates a new cookie jar persisted in the file located at path
+// A missing file is created once the first cookie is set.
+func NewFileCookieJar(path string) (FileCookieJar, error) {
+	// Create in-memory jar
+	jar, e := NewMemoryCookieJar()
+	if e != nil {
+		return nil, e
+	}
+	j := &fileCookieJar{
+		cookies: make(map[string]fileCookie),
+		jar:     jar,
+		path:    path,
+	}
+
+	// Read file
+	b, e := ioutil.ReadFile(path)
+	if os.IsNotExist(e) {
+		return j, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	// Decode cookies
+	var cs []fileCookie
+	if e = json.Unmarshal(b, &cs); e != nil {
+		return nil, e
+	}
+
+	// Load cookies
+	now := time.Now()
+	for _, c := range cs {
+		if c.Expires != nil && !c.Expires.After(now) {
+			continue
+		}
+		u, e := url.Parse(c.URL)
+		if e != nil {
+			continue
+		}
+		hc := &http.Cookie{
+			Domain:   c.Domain,
+			HttpOnly: c.HttpOnly,
+			Name:     c.Name,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			Value:    c.Value,
+		}
+		if c.Expires != nil {
+			hc.Expires = *c.Expires
+		}
+		j.jar.SetCookies(u, []*http.Cookie{hc})
+		j.cookies[fileCookieKey(u, hc)] = c
+	}
+	return j, nil
+}
+
+func fileCookieKey(u *url.URL, c *http.Cookie) string {
+	d := c.Domain
+	if d == "" {
+		d = u.Hostname()
+	}
+	return d + ";" + c.Path + ";" + c.Name
+}
+
+// Cookies implements the http.CookieJar interface
+func (j *fileCookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements the http.CookieJar interface
+func (j *fileCookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	// Update in-memory jar
+	j.jar.SetCookies(u, cookies)
+
+	// Update persisted cookies
+	j.mutex.Lock()
+	now := time.Now()
+	for _, c := range cookies {
+		// Deleted cookie
+		k := fileCookieKey(u, c)
+		if c.MaxAge < 0 || (c.MaxAge == 0 && !c.Expires.IsZero() && !c.Expires.After(now)) {
+			delete(j.cookies, k)
+			continue
+		}
+
+		// Add cookie
+		fc := fileCookie{
+			Domain:   c.Domain,
+			HttpOnly: c.HttpOnly,
+			Name:     c.Name,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			URL:      (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String(),
+			Value:    c.Value,
+		}
+		if c.MaxAge > 0 {
+			t := now.Add(time.Duration(c.MaxAge) * time.Second)
+			fc.Expires = &t
+		} else if !c.Expires.IsZero() {
+			t := c.Expires
+			fc.Expires = &t
+		}
+		j.cookies[k] = fc
+	}
+	j.mutex.Unlock()
+
+	// Save
+	// The error is returned by Err
+	j.Save()
+}
+
+// Err returns the error of the last save
+func (j *fileCookieJar) Err() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.err
+}
+
+// Path returns the path of the file the cookies are persisted in
+func (j *fileCookieJar) Path() string {
+	return j.path
+}
+
+// Save writes the cookies that have not expired in the file
+func (j *fileCookieJar) Save() error {
+	// Lock
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// Save
+	j.err = j.save()
+	return j.err
+}
+
+func (j *fileCookieJar) save() error {
+	// Get cookies
+	var ks []string
+	for k := range j.cookies {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	cs := []fileCookie{}
+	now := time.Now()
+	for _, k := range ks {
+		if c := j.cookies[k]; c.Expires == nil || c.Expires.After(now) {
+			cs = append(cs, c)
+		}
+	}
+
+	// Encode cookies
+	b, e := json.MarshalIndent(cs, "", "  ")
+	if e != nil {
+		return e
+	}
+
+	// Write file
+	// The file is replaced at once so that it's never partially written
+	tmp := j.path + ".tmp"
+	if e = ioutil.WriteFile(tmp, b, 0600); e != nil {
+		return e
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// SetCookieJar sets the jar storing the cookies received by the requests and sending them back
+// A nil jar, which is the default, disables cookies. Request sets can have their own jar.
+func (g *gozzle) SetCookieJar(j http.CookieJar) Gozzle {
+	g.client.Jar = j
+	g.cookieErr = nil
+	return g
+}
+
+// CookieJar returns the jar storing the cookies received by the requests
+func (g *gozzle) CookieJar() http.CookieJar {
+	return g.client.Jar
+}
+
+// SetCookieJarIsolation sets whether each execution of a request set without its own jar gets a new in-memory jar
+// instead of using the gozzle jar
+func (g *gozzle) SetCookieJarIsolation(i bool) Gozzle {
+	g.cookieJarIsolation = i
+	return g
+}
+
+// CookieJarIsolation returns whether each execution of a request set gets a new in-memory jar
+func (g *gozzle) CookieJarIsolation() bool {
+	return g.cookieJarIsolation
+}
+
+// requestSetClient returns the http client sending the requests of the request set
+func (g gozzle) requestSetClient(reqSet RequestSet) *http.Client {
+	// Get jar
+	j := reqSet.CookieJar()
+	if j == nil && g.cookieJarIsolation {
+		j, _ = NewMemoryCookieJar()
+	}
+
+	// Use gozzle client
+	if j == nil {
+		return g.client
+	}
+
+	// Copy client
+	c := *g.client
+	c.Jar = j
+	return &c
+}
+
+// Cookies returns the cookies set by the response
+func (r *response) Cookies() []*http.Cookie {
+	if r.originalResponse == nil {
+		return nil
+	}
+	return r.originalResponse.Cookies()
+}
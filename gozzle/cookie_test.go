@@ -0,0 +1,174 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCookieServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+		case "/me":
+			if c, e := r.Cookie("session"); e == nil {
+				w.Write([]byte(c.Value))
+			}
+		}
+	}))
+}
+
+func execTestCookieRequests(g Gozzle, reqSet RequestSet, s *httptest.Server, paths ...string) ResponseSet {
+	if reqSet == nil {
+		reqSet = NewOrderedRequestSet()
+	}
+	for _, p := range paths {
+		reqSet.AddRequest(NewRequest(p, MethodGet, s.URL+"/"+p))
+	}
+	return g.Exec(reqSet)
+}
+
+func responseBody(t *testing.T, respSet ResponseSet, name string) string {
+	b, e := respSet.GetResponse(name).Body()
+	assert.NoError(t, e)
+	return string(b)
+}
+
+func TestExecCookieJar(t *testing.T) {
+	// Initialize
+	s := newTestCookieServer()
+	defer s.Close()
+	g := NewGozzle()
+
+	// No jar
+	execTestCookieRequests(g, nil, s, "login")
+	assert.Equal(t, "", responseBody(t, execTestCookieRequests(g, nil, s, "me"), "me"))
+
+	// Memory jar
+	j, e := NewMemoryCookieJar()
+	assert.NoError(t, e)
+	g.SetCookieJar(j)
+	respSet := execTestCookieRequests(g, nil, s, "login")
+	cs := respSet.GetResponse("login").Cookies()
+	assert.Len(t, cs, 1)
+	assert.Equal(t, "session", cs[0].Name)
+	assert.Equal(t, "abc", responseBody(t, execTestCookieRequests(g, nil, s, "me"), "me"))
+
+	// Request set jar
+	rj, _ := NewMemoryCookieJar()
+	assert.Equal(t, "", responseBody(t, execTestCookieRequests(g, NewRequestSet().SetCookieJar(rj), s, "me"), "me"))
+
+	// Isolation
+	g.SetCookieJarIsolation(true)
+	assert.Equal(t, "", responseBody(t, execTestCookieRequests(g, nil, s, "me"), "me"))
+	respSet = execTestCookieRequests(g.SetConcurrency(1), nil, s, "login", "me")
+	assert.Equal(t, "abc", responseBody(t, respSet, "me"))
+	assert.Equal(t, "", responseBody(t, execTestCookieRequests(g, nil, s, "me"), "me"))
+
+	// No cookies
+	assert.Nil(t, NewResponseError(ErrNilOriginalResponse).Cookies())
+}
+
+func TestMemoryCookieJarPublicSuffix(t *testing.T) {
+	j, e := NewMemoryCookieJar()
+	assert.NoError(t, e)
+	u, _ := url.Parse("http://www.example.co.uk")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", Domain: "co.uk"}, {Name: "b", Value: "2", Domain: "example.co.uk"}})
+	cs := j.Cookies(u)
+	assert.Len(t, cs, 1)
+	assert.Equal(t, "b", cs[0].Name)
+}
+
+func TestFileCookieJar(t *testing.T) {
+	// Initialize
+	s := newTestCookieServer()
+	defer s.Close()
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "cookies.json")
+
+	// Missing file
+	j, e := NewFileCookieJar(p)
+	assert.NoError(t, e)
+	assert.Equal(t, p, j.Path())
+	execTestCookieRequests(NewGozzle().SetCookieJar(j), nil, s, "login")
+	b, e := ioutil.ReadFile(p)
+	assert.NoError(t, e)
+	assert.Contains(t, string(b), `"value": "abc"`)
+
+	// Load file
+	j, e = NewFileCookieJar(p)
+	assert.NoError(t, e)
+	g := NewGozzle().SetCookieJar(j)
+	assert.Equal(t, "abc", responseBody(t, execTestCookieRequests(g, nil, s, "me"), "me"))
+
+	// Deleted cookie
+	execTestCookieRequests(g, nil, s, "logout")
+	b, e = ioutil.ReadFile(p)
+	assert.NoError(t, e)
+	assert.Equal(t, "[]", strings.TrimSpace(string(b)))
+
+	// Save error
+	assert.NoError(t, j.Err())
+	j, e = NewFileCookieJar(filepath.Join(dir, "missing", "cookies.json"))
+	assert.NoError(t, e)
+	execTestCookieRequests(NewGozzle().SetCookieJar(j), nil, s, "login")
+	assert.Error(t, j.Err())
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "missing"), 0700))
+	assert.NoError(t, j.Save())
+	assert.NoError(t, j.Err())
+
+	// Invalid file
+	assert.NoError(t, ioutil.WriteFile(p, []byte("invalid"), 0600))
+	_, e = NewFileCookieJar(p)
+	assert.Error(t, e)
+}
+
+func TestNewGozzleFromConfigurationCookies(t *testing.T) {
+	assert.Nil(t, NewGozzleFromConfiguration(Configuration{}).CookieJar())
+	assert.NotNil(t, NewGozzleFromConfiguration(Configuration{Cookies: &CookieConfiguration{}}).CookieJar())
+	g := NewGozzleFromConfiguration(Configuration{Cookies: &CookieConfiguration{Isolated: true}})
+	assert.Nil(t, g.CookieJar())
+	assert.True(t, g.CookieJarIsolation())
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	j, ok := NewGozzleFromConfiguration(Configuration{Cookies: &CookieConfiguration{File: filepath.Join(dir, "c.json")}}).CookieJar().(FileCookieJar)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "c.json"), j.Path())
+
+	// Invalid file
+	s := newTestCookieServer()
+	defer s.Close()
+	p := filepath.Join(dir, "invalid.json")
+	assert.NoError(t, ioutil.WriteFile(p, []byte("invalid"), 0600))
+	g = NewGozzleFromConfiguration(Configuration{Cookies: &CookieConfiguration{File: p}})
+	assert.Nil(t, g.CookieJar())
+	resp := execTestCookieRequests(g, nil, s, "login").GetResponse("login")
+	assert.Len(t, resp.Errors(), 1)
+	g.SetCookieJar(nil)
+	assert.Empty(t, execTestCookieRequests(g, nil, s, "login").GetResponse("login").Errors())
+
+	// File and isolation
+	g = NewGozzleFromConfiguration(Configuration{Cookies: &CookieConfiguration{File: filepath.Join(dir, "c.json"), Isolated: true}})
+	assert.Nil(t, g.CookieJar())
+	resp = execTestCookieRequests(g, nil, s, "login").GetResponse("login")
+	assert.Len(t, resp.Errors(), 1)
+	assert.True(t, errors.Is(resp.Errors()[0], ErrInvalidCookieConfiguration))
+}
@@ -0,0 +1,140 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings
+const (
+	EncodingBrotli  string = "br"
+	EncodingDeflate string = "deflate"
+	EncodingGzip    string = "gzip"
+	EncodingZstd    string = "zstd"
+)
+
+// Constants
+const (
+	acceptEncoding = "gzip, deflate, br, zstd"
+)
+
+// negotiateEncoding advertises the supported encodings unless the request has set its own Accept-Encoding header
+func negotiateEncoding(httpReq *http.Request) {
+	if httpReq.Header.Get("Accept-Encoding") == "" && httpReq.Method != MethodHead {
+		httpReq.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+}
+
+// decompressBody decodes the response body based on its Content-Encoding header
+// Unsupported encodings are left untouched
+func (r *response) decompressBody() {
+	// Nothing to decode
+	or := r.originalResponse
+	if or.Body == nil || or.Header == nil {
+		return
+	}
+
+	// Get encodings
+	var es []string
+	for _, v := range strings.Split(or.Header.Get("Content-Encoding"), ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" && v != "identity" {
+			es = append(es, v)
+		}
+	}
+	if len(es) == 0 {
+		return
+	}
+
+	// Check encodings are supported
+	for _, e := range es {
+		switch e {
+		case EncodingBrotli, EncodingDeflate, EncodingGzip, "x-gzip", EncodingZstd:
+		default:
+			return
+		}
+	}
+
+	// Update body
+	or.Body = &decompressReadCloser{encodings: es, rc: or.Body}
+	or.Header.Del("Content-Encoding")
+	or.Header.Del("Content-Length")
+	or.ContentLength = -1
+	or.Uncompressed = true
+}
+
+// decompressReadCloser creates its decoders lazily so that creating the response doesn't block on reading the body
+type decompressReadCloser struct {
+	closers   []func()
+	encodings []string
+	err       error
+	r         io.Reader
+	rc        io.ReadCloser
+}
+
+func (d *decompressReadCloser) init() {
+	// Encodings are listed in the order they were applied
+	d.r = d.rc
+	for i := len(d.encodings) - 1; i >= 0; i-- {
+		switch d.encodings[i] {
+		case EncodingBrotli:
+			d.r = brotli.NewReader(d.r)
+		case EncodingDeflate:
+			d.r, d.err = newDeflateReader(d.r)
+		case EncodingGzip, "x-gzip":
+			d.r, d.err = gzip.NewReader(d.r)
+		case EncodingZstd:
+			var z *zstd.Decoder
+			if z, d.err = zstd.NewReader(d.r, zstd.WithDecoderConcurrency(1)); d.err == nil {
+				d.closers = append(d.closers, z.Close)
+				d.r = z
+			}
+		}
+		if d.err != nil {
+			return
+		}
+	}
+}
+
+// Read implements the io.Reader interface
+func (d *decompressReadCloser) Read(p []byte) (int, error) {
+	if d.r == nil && d.err == nil {
+		d.init()
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.r.Read(p)
+}
+
+// Close implements the io.Closer interface
+func (d *decompressReadCloser) Close() error {
+	for _, c := range d.closers {
+		c()
+	}
+	return d.rc.Close()
+}
+
+// newDeflateReader handles both zlib wrapped (RFC 1950) and raw (RFC 1951) deflate streams since servers send either
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	// Peek header
+	br := bufio.NewReader(r)
+	h, _ := br.Peek(2)
+
+	// Zlib
+	if len(h) == 2 && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func compressTestBody(t *testing.T, encoding string, b []byte) []byte {
+	// Create writer
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case EncodingBrotli:
+		w = brotli.NewWriter(buf)
+	case EncodingGzip:
+		w = gzip.NewWriter(buf)
+	case EncodingZstd:
+		var e error
+		w, e = zstd.NewWriter(buf)
+		assert.NoError(t, e)
+	case "zlib":
+		w = zlib.NewWriter(buf)
+	case "flate":
+		w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+	}
+
+	// Write
+	_, e := w.Write(b)
+	assert.NoError(t, e)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestExecDecompression(t *testing.T) {
+	// Initialize
+	m := []byte("testmessage")
+
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+		var b []byte
+		switch e := r.URL.Query().Get("encoding"); e {
+		case "zlib", "flate":
+			w.Header().Set("Content-Encoding", EncodingDeflate)
+			b = compressTestBody(t, e, m)
+		case "gzip, br":
+			w.Header().Set("Content-Encoding", e)
+			b = compressTestBody(t, EncodingBrotli, compressTestBody(t, EncodingGzip, m))
+		default:
+			w.Header().Set("Content-Encoding", e)
+			b = compressTestBody(t, e, m)
+		}
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	// Create request set
+	reqSet := NewRequestSet()
+	for _, e := range []string{EncodingBrotli, EncodingGzip, EncodingZstd, "zlib", "flate", "gzip, br"} {
+		reqSet.AddRequest(NewRequest(e, MethodGet, server.URL).AddQuery("encoding", e))
+	}
+
+	// Execute requests
+	respSet := NewGozzle().Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	for _, name := range respSet.Names() {
+		resp := respSet.GetResponse(name)
+		assert.Len(t, resp.Errors(), 0)
+		assert.Empty(t, resp.Header().Get("Content-Encoding"), name)
+		b, e := resp.Body()
+		assert.NoError(t, e, name)
+		assert.Equal(t, m, b, name)
+	}
+}
+
+func TestExecDecompressionDisabled(t *testing.T) {
+	// Initialize
+	m := compressTestBody(t, EncodingGzip, []byte("testmessage"))
+
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", EncodingGzip)
+		w.Write(m)
+	}))
+	defer server.Close()
+
+	// Execute requests
+	g := NewGozzle().SetDecompression(false)
+	respSet := g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, server.URL)))
+	defer respSet.Close()
+
+	// Assert
+	resp := respSet.GetResponse("test")
+	assert.Len(t, resp.Errors(), 0)
+	assert.Equal(t, EncodingGzip, resp.Header().Get("Content-Encoding"))
+	b, e := resp.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, m, b)
+	assert.True(t, NewGozzleFromConfiguration(Configuration{DisableDecompression: true}).(*gozzle).transport.DisableCompression)
+	assert.False(t, g.SetDecompression(true).(*gozzle).transport.DisableCompression)
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	// Initialize
+	b := compressTestBody(t, EncodingGzip, make([]byte, 1<<20))
+
+	// Create response
+	r := NewResponse(&http.Response{
+		Body:          mockedIoReaderCloser(b),
+		ContentLength: int64(len(b)),
+		Header:        http.Header{"Content-Encoding": []string{EncodingGzip}},
+		StatusCode:    200,
+	}, 1024)
+
+	// Assert
+	b, e := r.Body()
+	assert.NoError(t, e)
+	assert.Len(t, b, 1024)
+	assert.Equal(t, []error{ErrBodyTooLarge}, r.Errors())
+}
+
+func TestDecompressionUnsupported(t *testing.T) {
+	// Create response
+	r := NewResponse(&http.Response{
+		Body:       mockedIoReaderCloser([]byte("test")),
+		Header:     http.Header{"Content-Encoding": []string{"compress"}},
+		StatusCode: 200,
+	}, 0)
+
+	// Assert
+	b, e := r.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+	assert.Equal(t, "compress", r.Header().Get("Content-Encoding"))
+}
@@ -0,0 +1,482 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variables
+var (
+	regexpDefinitionLine     = regexp.MustCompile(`line (\d+)`)
+	regexpDefinitionVariable = regexp.MustCompile(`\$\$|\$\{([^}]*)\}`)
+)
+
+// RequestSetDefinition represents a JSON/YAML-friendly request set definition
+//
+// String values of requests and configuration can reference variables with ${NAME}. Variables are looked up in the
+// variables provided to the loader, then in the definition Variables and then in the environment. Use $$ to write a
+// literal $.
+type RequestSetDefinition struct {
+	Configuration *Configuration      `json:"configuration,omitempty"`
+	Requests      []RequestDefinition `json:"requests"`
+	Variables     map[string]string   `json:"variables,omitempty"`
+}
+
+// RequestDefinition represents a JSON/YAML-friendly request definition
+// Method defaults to GET. A string body is sent as is whereas other bodies are encoded like with SetBody. Expected
+// status codes are also considered successful. Extract maps variable names, which other requests can reference with
+// {{name}} templates, to their extraction rules.
+type RequestDefinition struct {
+	Body    interface{}                     `json:"body,omitempty"`
+	Expect  *ExpectationDefinition          `json:"expect,omitempty"`
+	Extract map[string]ExtractionDefinition `json:"extract,omitempty"`
+	Headers map[string]string               `json:"headers,omitempty"`
+	Method  string                          `json:"method,omitempty"`
+	Name    string                          `json:"name"`
+	Path    string                          `json:"path"`
+	Query   map[string]string               `json:"query,omitempty"`
+}
+
+// DefinitionError represents an error located in a definition file
+type DefinitionError struct {
+	Line    int
+	Message string
+}
+
+// Error implements the error interface
+func (e *DefinitionError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+// DefinitionErrors represents the list of errors found in a definition file
+type DefinitionErrors []*DefinitionError
+
+// Error implements the error interface
+func (es DefinitionErrors) Error() string {
+	var ss []string
+	for _, e := range es {
+		ss = append(ss, e.Error())
+	}
+	return strings.Join(ss, "\n")
+}
+
+// LoadRequestSet loads a request set from a JSON or YAML definition file
+func LoadRequestSet(path string, vars map[string]string) (RequestSet, error) {
+	d, e := LoadRequestSetDefinition(path, vars)
+	if e != nil {
+		return nil, e
+	}
+	return d.RequestSet(), nil
+}
+
+// LoadRequestSetDefinition loads a request set definition from a JSON or YAML file
+func LoadRequestSetDefinition(path string, vars map[string]string) (d RequestSetDefinition, e error) {
+	var b []byte
+	if b, e = ioutil.ReadFile(path); e != nil {
+		return
+	}
+	if d, e = ParseRequestSetDefinition(b, vars); e != nil {
+		e = fmt.Errorf("%s: %w", path, e)
+	}
+	return
+}
+
+// ParseRequestSetDefinition parses a JSON or YAML request set definition, validates it and interpolates its variables
+func ParseRequestSetDefinition(b []byte, vars map[string]string) (d RequestSetDefinition, e error) {
+	// Parse
+	var doc yaml.Node
+	if e = yaml.Unmarshal(b, &doc); e != nil {
+		de := &DefinitionError{Message: strings.TrimPrefix(e.Error(), "yaml: ")}
+		if m := regexpDefinitionLine.FindStringSubmatch(de.Message); len(m) > 1 {
+			de.Line, _ = strconv.Atoi(m[1])
+			de.Message = strings.TrimPrefix(strings.TrimPrefix(de.Message, m[0]), ": ")
+		}
+		return d, DefinitionErrors{de}
+	}
+
+	// Empty document
+	if len(doc.Content) == 0 {
+		return d, DefinitionErrors{{Message: "empty definition"}}
+	}
+	root := doc.Content[0]
+
+	// Validate
+	v := &definitionValidator{}
+	v.validateRoot(root)
+	if len(v.errs) > 0 {
+		return d, v.errs
+	}
+
+	// Interpolate
+	i := &definitionInterpolator{vars: vars}
+	i.addVariables(root)
+	i.interpolate(root, "variables")
+	if len(i.errs) > 0 {
+		return d, i.errs
+	}
+
+	// Decode through JSON so that JSON tags and unmarshalers are used
+	var raw interface{}
+	if e = root.Decode(&raw); e != nil {
+		return d, DefinitionErrors{{Line: root.Line, Message: e.Error()}}
+	}
+	var j []byte
+	if j, e = json.Marshal(raw); e != nil {
+		return d, DefinitionErrors{{Line: root.Line, Message: e.Error()}}
+	}
+	if e = json.Unmarshal(j, &d); e != nil {
+		line := root.Line
+		if n := mappingValue(root, "configuration"); n != nil {
+			line = n.Line
+		}
+		return d, DefinitionErrors{{Line: line, Message: e.Error()}}
+	}
+	return
+}
+
+// RequestSet creates the ordered request set described by the definition
+func (d RequestSetDefinition) RequestSet() RequestSet {
+	reqSet := NewOrderedRequestSet()
+	for _, r := range d.Requests {
+		reqSet.AddRequest(r.Request())
+	}
+	return reqSet
+}
+
+// Request creates the request described by the definition
+func (d RequestDefinition) Request() Request {
+	// Create request
+	m := strings.ToUpper(d.Method)
+	if m == "" {
+		m = MethodGet
+	}
+	r := NewRequest(d.Name, m, d.Path)
+
+	// Add headers and query
+	for k, v := range d.Headers {
+		r.AddHeader(k, v)
+	}
+	for k, v := range d.Query {
+		r.AddQuery(k, v)
+	}
+
+	// Set body
+	if s, ok := d.Body.(string); ok {
+		r.SetBody(RawBody(s))
+	} else if d.Body != nil {
+		r.SetBody(d.Body)
+	}
+
+	// Add extractors
+	var vs []string
+	for v := range d.Extract {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	for _, v := range vs {
+		r.AddExtractor(d.Extract[v].Extractor(v))
+	}
+
+	// Add expectations
+	if d.Expect != nil {
+		r.SetExpectations(d.Expect.Expectations())
+		if len(d.Expect.Status) > 0 {
+			r.SetSuccessPolicy(StatusCodes(d.Expect.Status...))
+		}
+	}
+	return r
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+type definitionValidator struct {
+	errs DefinitionErrors
+}
+
+func (v *definitionValidator) errorf(n *yaml.Node, format string, args ...interface{}) {
+	v.errs = append(v.errs, &DefinitionError{Line: n.Line, Message: fmt.Sprintf(format, args...)})
+}
+
+// mapping checks the node is a mapping whose keys are allowed and returns its values indexed by key
+func (v *definitionValidator) mapping(n *yaml.Node, name string, allowed ...string) map[string]*yaml.Node {
+	// Check kind
+	if n.Kind != yaml.MappingNode {
+		v.errorf(n, "%s must be an object", name)
+		return nil
+	}
+
+	// Loop through keys
+	m := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if _, ok := m[k.Value]; ok {
+			v.errorf(k, "%s: duplicate key %q", name, k.Value)
+			continue
+		}
+		if len(allowed) > 0 {
+			var ok bool
+			for _, a := range allowed {
+				if a == k.Value {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				v.errorf(k, "%s: unknown key %q", name, k.Value)
+				continue
+			}
+		}
+		m[k.Value] = n.Content[i+1]
+	}
+	return m
+}
+
+// scalars checks the node is a mapping of scalars
+func (v *definitionValidator) scalars(n *yaml.Node, name string) {
+	for k, c := range v.mapping(n, name) {
+		if c.Kind != yaml.ScalarNode {
+			v.errorf(c, "%s: %s must be a string", name, k)
+		}
+	}
+}
+
+func (v *definitionValidator) validateRoot(n *yaml.Node) {
+	// Root
+	m := v.mapping(n, "definition", "configuration", "requests", "variables")
+	if m == nil {
+		return
+	}
+
+	// Configuration
+	if c, ok := m["configuration"]; ok && c.Kind != yaml.MappingNode {
+		v.errorf(c, "configuration must be an object")
+	}
+
+	// Variables
+	if c, ok := m["variables"]; ok {
+		v.scalars(c, "variables")
+	}
+
+	// Requests
+	rs, ok := m["requests"]
+	if !ok {
+		v.errorf(n, "requests is required")
+		return
+	} else if rs.Kind != yaml.SequenceNode {
+		v.errorf(rs, "requests must be an array")
+		return
+	}
+	names := make(map[string]int)
+	for i, r := range rs.Content {
+		v.validateRequest(r, i, names)
+	}
+}
+
+func (v *definitionValidator) validateRequest(n *yaml.Node, idx int, names map[string]int) {
+	// Mapping
+	name := fmt.Sprintf("requests[%d]", idx)
+	m := v.mapping(n, name, "body", "expect", "extract", "headers", "method", "name", "path", "query")
+	if m == nil {
+		return
+	}
+
+	// Required strings
+	for _, k := range []string{"name", "path"} {
+		if c, ok := m[k]; !ok {
+			v.errorf(n, "%s: %s is required", name, k)
+		} else if c.Kind != yaml.ScalarNode || c.Value == "" {
+			v.errorf(c, "%s: %s must be a non-empty string", name, k)
+		}
+	}
+
+	// Unique name
+	if c, ok := m["name"]; ok && c.Kind == yaml.ScalarNode && c.Value != "" {
+		if l, ok := names[c.Value]; ok {
+			v.errorf(c, "%s: name %q is already used at line %d", name, c.Value, l)
+		} else {
+			names[c.Value] = c.Line
+		}
+	}
+
+	// Method
+	if c, ok := m["method"]; ok {
+		switch strings.ToUpper(c.Value) {
+		case MethodGet, MethodPost, MethodPut, MethodPatch, MethodDelete, MethodOptions, MethodHead:
+		default:
+			v.errorf(c, "%s: invalid method %q", name, c.Value)
+		}
+	}
+
+	// Headers and query
+	for _, k := range []string{"headers", "query"} {
+		if c, ok := m[k]; ok {
+			v.scalars(c, name+"."+k)
+		}
+	}
+
+	// Expectations
+	if c, ok := m["expect"]; ok {
+		v.validateExpect(c, name+".expect")
+	}
+
+	// Extractors
+	if c, ok := m["extract"]; ok {
+		for k, x := range v.mapping(c, name+".extract") {
+			v.validateExtract(x, name+".extract."+k)
+		}
+	}
+}
+
+func (v *definitionValidator) validateExtract(n *yaml.Node, name string) {
+	// Mapping
+	m := v.mapping(n, name, "header", "json", "regexp", "xpath")
+	if m == nil {
+		return
+	}
+
+	// Rule
+	if len(m) != 1 {
+		v.errorf(n, "%s: exactly one of header, json, regexp and xpath is required", name)
+		return
+	}
+	for k, c := range m {
+		if c.Kind != yaml.ScalarNode || c.Value == "" {
+			v.errorf(c, "%s: %s must be a non-empty string", name, k)
+		}
+	}
+}
+
+func (v *definitionValidator) validateExpect(n *yaml.Node, name string) {
+	// Mapping
+	m := v.mapping(n, name, "headers", "headers_match", "json", "json_match", "json_schema", "max_latency", "status")
+	if m == nil {
+		return
+	}
+
+	// Status
+	if c, ok := m["status"]; ok {
+		if c.Kind != yaml.SequenceNode {
+			v.errorf(c, "%s: status must be an array", name)
+		} else {
+			for _, s := range c.Content {
+				if s.Tag != "!!int" {
+					v.errorf(s, "%s: invalid status %q", name, s.Value)
+				}
+			}
+		}
+	}
+
+	// Strings
+	for _, k := range []string{"headers", "headers_match", "json_match"} {
+		if c, ok := m[k]; ok {
+			v.scalars(c, name+"."+k)
+		}
+	}
+
+	// JSON
+	if c, ok := m["json"]; ok {
+		v.mapping(c, name+".json")
+	}
+	if c, ok := m["json_schema"]; ok && c.Kind != yaml.MappingNode && c.Kind != yaml.ScalarNode {
+		v.errorf(c, "%s: json_schema must be an object or a string", name)
+	}
+
+	// Max latency
+	if c, ok := m["max_latency"]; ok {
+		if c.Kind != yaml.ScalarNode {
+			v.errorf(c, "%s: max_latency must be a duration", name)
+		} else if c.Tag == "!!str" {
+			if _, e := time.ParseDuration(c.Value); e != nil {
+				v.errorf(c, "%s: invalid max_latency %q", name, c.Value)
+			}
+		}
+	}
+}
+
+type definitionInterpolator struct {
+	errs      DefinitionErrors
+	variables map[string]string
+	vars      map[string]string
+}
+
+func (i *definitionInterpolator) lookup(name string) (string, bool) {
+	if v, ok := i.vars[name]; ok {
+		return v, true
+	} else if v, ok := i.variables[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+func (i *definitionInterpolator) replace(n *yaml.Node) {
+	n.Value = regexpDefinitionVariable.ReplaceAllStringFunc(n.Value, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		name := m[2 : len(m)-1]
+		v, ok := i.lookup(name)
+		if !ok {
+			i.errs = append(i.errs, &DefinitionError{Line: n.Line, Message: fmt.Sprintf("undefined variable %q", name)})
+		}
+		return v
+	})
+}
+
+// addVariables interpolates the definition variables, which can only reference provided and environment variables
+func (i *definitionInterpolator) addVariables(root *yaml.Node) {
+	i.variables = make(map[string]string)
+	n := mappingValue(root, "variables")
+	if n == nil {
+		return
+	}
+	for j := 0; j+1 < len(n.Content); j += 2 {
+		i.replace(n.Content[j+1])
+		i.variables[n.Content[j].Value] = n.Content[j+1].Value
+	}
+}
+
+// interpolate replaces variables in all string values of the node except the ones under the skipped key
+func (i *definitionInterpolator) interpolate(n *yaml.Node, skip string) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" || n.Tag == "" {
+			i.replace(n)
+		}
+	case yaml.MappingNode:
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Value != skip {
+				i.interpolate(n.Content[j+1], "")
+			}
+		}
+	case yaml.SequenceNode:
+		for _, c := range n.Content {
+			i.interpolate(c, "")
+		}
+	}
+}
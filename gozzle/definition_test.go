@@ -0,0 +1,119 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequestSetDefinitionYAML(t *testing.T) {
+	// Initialize
+	os.Setenv("GOZZLE_TEST_TOKEN", "token")
+	defer os.Unsetenv("GOZZLE_TEST_TOKEN")
+
+	// Parse
+	d, e := ParseRequestSetDefinition([]byte(`
+configuration:
+  max_size_body: 10
+  circuit_breaker:
+    cool_down: 1s
+variables:
+  base: ${BASE}/v1
+requests:
+  - name: list
+    path: ${base}/items
+    headers:
+      Authorization: Bearer ${GOZZLE_TEST_TOKEN}
+    query:
+      price: $$10
+  - name: create
+    method: post
+    path: ${base}/items
+    body:
+      name: ${base}
+      count: 2
+  - name: raw
+    method: PUT
+    path: /raw
+    body: raw
+`), map[string]string{"BASE": "http://example.com"})
+	assert.NoError(t, e)
+
+	// Assert
+	assert.Equal(t, 10, d.Configuration.MaxSizeBody)
+	assert.Equal(t, Duration(time.Second), d.Configuration.CircuitBreaker.CoolDown)
+	reqSet := d.RequestSet()
+	r := reqSet.GetRequest("list")
+	assert.Equal(t, MethodGet, r.Method())
+	assert.Equal(t, "http://example.com/v1/items?price=%2410", r.FullPath())
+	assert.Equal(t, "Bearer token", r.GetHeader("Authorization"))
+	r = reqSet.GetRequest("create")
+	assert.Equal(t, MethodPost, r.Method())
+	assert.Equal(t, map[string]interface{}{"name": "http://example.com/v1", "count": 2.0}, r.Body())
+	assert.Equal(t, RawBody("raw"), reqSet.GetRequest("raw").Body())
+}
+
+func TestParseRequestSetDefinitionJSON(t *testing.T) {
+	// Parse
+	d, e := ParseRequestSetDefinition([]byte("{\n\t\"requests\": [\n\t\t{\"name\": \"test\", \"path\": \"/test\"}\n\t]\n}"), nil)
+	assert.NoError(t, e)
+
+	// Assert
+	assert.Len(t, d.Requests, 1)
+	assert.Equal(t, "/test", d.Requests[0].Path)
+}
+
+func TestParseRequestSetDefinitionErrors(t *testing.T) {
+	// Syntax
+	_, e := ParseRequestSetDefinition([]byte("{\n\"requests\": [\n}"), nil)
+	assert.IsType(t, DefinitionErrors{}, e)
+	assert.Equal(t, 2, e.(DefinitionErrors)[0].Line)
+
+	// Schema
+	_, e = ParseRequestSetDefinition([]byte(`requests:
+  - name: test
+    path: /test
+    unknown: true
+  - name: test
+    method: TEST
+  - path: /test
+    headers:
+      a: [b]
+`), nil)
+	assert.EqualError(t, e, `line 4: requests[0]: unknown key "unknown"
+line 5: requests[1]: path is required
+line 5: requests[1]: name "test" is already used at line 2
+line 6: requests[1]: invalid method "TEST"
+line 7: requests[2]: name is required
+line 9: requests[2].headers: a must be a string`)
+
+	// Variables
+	_, e = ParseRequestSetDefinition([]byte("requests:\n  - name: test\n    path: ${GOZZLE_TEST_UNDEFINED}"), nil)
+	assert.EqualError(t, e, `line 3: undefined variable "GOZZLE_TEST_UNDEFINED"`)
+
+	// Configuration
+	_, e = ParseRequestSetDefinition([]byte("configuration:\n  max_size_body: test\nrequests: []"), nil)
+	assert.Equal(t, 2, e.(DefinitionErrors)[0].Line)
+}
+
+func TestLoadRequestSet(t *testing.T) {
+	// Create file
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "test.yml")
+	assert.NoError(t, ioutil.WriteFile(p, []byte("requests:\n  - name: test\n    path: /test"), 0600))
+
+	// Load
+	reqSet, e := LoadRequestSet(p, nil)
+	assert.NoError(t, e)
+	assert.Equal(t, []string{"test"}, reqSet.Names())
+}
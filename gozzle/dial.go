@@ -0,0 +1,233 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Constants
+const (
+	defaultDialKeepAlive = 30 * time.Second
+	defaultDialTimeout   = 30 * time.Second
+	unixSocketHost       = "unix"
+)
+
+// Variables
+var (
+	ErrInvalidSourceIP = errors.New("Invalid source IP")
+	unixSocketSchemes  = []string{"http+unix://", "unix://"}
+)
+
+// DialConfiguration represents a JSON-friendly configuration of the connections opened by gozzle
+// Hosts maps host names to the IP addresses they resolve to, like /etc/hosts. Other host names are resolved by
+// Nameservers, in "ip:port" format and queried in turn, or by the system resolver. SourceIP is the local IP address
+// connections are bound to. Timeout defaults to 30s.
+//
+// Requests can also target Unix domain sockets with the unix:// or http+unix:// schemes, the URL-escaped path of the
+// socket being the host, such as unix://%2Fvar%2Frun%2Fdocker.sock/containers/json. They're sent with "unix" as Host
+// header and never go through proxies. Circuit breakers and rate limits key them on the path of the socket.
+type DialConfiguration struct {
+	Hosts       map[string]string `json:"hosts"`
+	Nameservers []string          `json:"nameservers"`
+	SourceIP    string            `json:"source_ip"`
+	Timeout     Duration          `json:"timeout"`
+}
+
+type dialer struct {
+	egress *egress
+	hosts  map[string]string
+	tcp    *net.Dialer
+	unix   *net.Dialer
+}
+
+type unixSocketContextKey struct{}
+
+// newDialer creates the dialer described by the configuration and enforcing the egress policy if any
+func newDialer(c DialConfiguration, p *EgressPolicy) (d *dialer, e error) {
+	// Initialize
+	t := time.Duration(c.Timeout)
+	if t <= 0 {
+		t = defaultDialTimeout
+	}
+	d = &dialer{
+		hosts: make(map[string]string),
+		tcp:   &net.Dialer{KeepAlive: defaultDialKeepAlive, Timeout: t},
+		unix:  &net.Dialer{Timeout: t},
+	}
+
+	// Egress policy
+	if p != nil {
+		if d.egress, e = newEgress(*p); e != nil {
+			return nil, e
+		}
+	}
+
+	// Hosts
+	for k, v := range c.Hosts {
+		d.hosts[strings.ToLower(k)] = v
+	}
+
+	// Source IP
+	if c.SourceIP != "" {
+		ip := net.ParseIP(c.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("%w %q", ErrInvalidSourceIP, c.SourceIP)
+		}
+		d.tcp.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	// Nameservers
+	if len(c.Nameservers) > 0 {
+		var i uint32
+		ns := append([]string(nil), c.Nameservers...)
+		d.tcp.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				n := ns[int(atomic.AddUint32(&i, 1)-1)%len(ns)]
+				return (&net.Dialer{Timeout: t}).DialContext(ctx, network, n)
+			},
+		}
+	}
+	return d, nil
+}
+
+// dialContext opens the connections of the transport
+func (d *dialer) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	// Split address
+	host, port, e := net.SplitHostPort(addr)
+	if e != nil {
+		return nil, e
+	}
+
+	// Unix socket
+	if s, ok := ctx.Value(unixSocketContextKey{}).(string); ok && host == unixSocketHost {
+		if d.egress != nil {
+			return nil, fmt.Errorf("%w: %s", ErrDestinationBlocked, s)
+		}
+		return d.unix.DialContext(ctx, "unix", s)
+	}
+
+	// Hosts
+	if ip, ok := d.hosts[strings.ToLower(host)]; ok {
+		addr = net.JoinHostPort(ip, port)
+	}
+
+	// Enforce egress policy once the address is resolved
+	if d.egress != nil {
+		td := *d.tcp
+		td.Control = d.egress.control(host)
+		return td.DialContext(ctx, network, addr)
+	}
+	return d.tcp.DialContext(ctx, network, addr)
+}
+
+// proxy is the transport proxy function
+// Since the dialer only sees the address of the proxy when one is used, the destination is checked against the egress
+// policy before going through the proxy: IP literals are checked directly whereas host names are resolved first.
+func (d *dialer) proxy(r *http.Request) (*url.URL, error) {
+	// Get proxy
+	u, e := proxyFromContext(r)
+	if e != nil || u == nil || d.egress == nil {
+		return u, e
+	}
+
+	// Check destination
+	if e = d.checkDestination(r.Context(), r.URL.Hostname()); e != nil {
+		return nil, e
+	}
+	return u, nil
+}
+
+// checkDestination checks every IP the host resolves to against the egress policy
+func (d *dialer) checkDestination(ctx context.Context, host string) error {
+	// Hosts
+	if ip, ok := d.hosts[strings.ToLower(host)]; ok {
+		return d.egress.check(host, net.ParseIP(ip))
+	}
+
+	// IP literal
+	if ip := net.ParseIP(host); ip != nil {
+		return d.egress.check(host, ip)
+	}
+
+	// Resolve
+	r := d.tcp.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	ips, e := r.LookupIPAddr(ctx, host)
+	if e != nil {
+		return d.egress.check(host, nil)
+	}
+
+	// Check IPs
+	for _, ip := range ips {
+		if e = d.egress.check(host, ip.IP); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// requestHost returns the host of the request, or the path of the socket it targets when it's sent through a Unix
+// domain socket, since all of them share the same URL host
+func requestHost(httpReq *http.Request) string {
+	if s, ok := httpReq.Context().Value(unixSocketContextKey{}).(string); ok && httpReq.URL.Hostname() == unixSocketHost {
+		return s
+	}
+	return httpReq.URL.Host
+}
+
+// unixSocketURL returns the path of the socket targeted by the URL and the http URL to request through it
+// Both are empty if the URL doesn't target a Unix domain socket
+func unixSocketURL(raw string) (socket, u string, e error) {
+	for _, p := range unixSocketSchemes {
+		// Check scheme
+		if len(raw) < len(p) || !strings.EqualFold(raw[:len(p)], p) {
+			continue
+		}
+
+		// Split host and path
+		host, path := raw[len(p):], ""
+		if i := strings.IndexAny(host, "/?#"); i > -1 {
+			host, path = host[:i], host[i:]
+		}
+
+		// Unescape socket path
+		if socket, e = url.PathUnescape(host); e != nil {
+			return "", "", e
+		} else if socket == "" {
+			return "", "", errors.New("missing socket path")
+		}
+		return socket, "http://" + unixSocketHost + path, nil
+	}
+	return "", "", nil
+}
+
+// SetDialConfiguration sets the configuration of the connections opened by gozzle
+// If the configuration is invalid, requests fail with the error until a valid configuration is set.
+func (g *gozzle) SetDialConfiguration(c DialConfiguration) Gozzle {
+	g.dialConfiguration = c
+	var d *dialer
+	if d, g.dialErr = newDialer(c, g.egressPolicy); g.dialErr == nil {
+		g.transport.DialContext = d.dialContext
+		g.transport.Proxy = d.proxy
+	}
+	return g
+}
+
+// DialConfiguration returns the configuration of the connections opened by gozzle
+func (g *gozzle) DialConfiguration() DialConfiguration {
+	return g.dialConfiguration
+}
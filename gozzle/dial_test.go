@@ -0,0 +1,171 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestNameserver creates a DNS server resolving every A query to 127.0.0.1
+func newTestNameserver(t *testing.T) net.PacketConn {
+	c, e := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, e)
+	go func() {
+		b := make([]byte, 512)
+		for {
+			// Read query
+			n, addr, e := c.ReadFrom(b)
+			if e != nil {
+				return
+			}
+			var m dnsmessage.Message
+			if e = m.Unpack(b[:n]); e != nil || len(m.Questions) == 0 {
+				continue
+			}
+
+			// Answer
+			q := m.Questions[0]
+			m.Header.Response = true
+			if q.Type == dnsmessage.TypeA {
+				m.Answers = []dnsmessage.Resource{{
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+					Header: dnsmessage.ResourceHeader{Class: q.Class, Name: q.Name, TTL: 60, Type: q.Type},
+				}}
+			}
+			r, e := m.Pack()
+			if e != nil {
+				continue
+			}
+			c.WriteTo(r, addr)
+		}
+	}()
+	return c
+}
+
+func TestExecUnixSocket(t *testing.T) {
+	// Create server
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "gozzle.sock")
+	l, e := net.Listen("unix", p)
+	assert.NoError(t, e)
+	s := &httptest.Server{
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Host + " " + r.URL.String()))
+		})},
+		Listener: l,
+	}
+	s.Start()
+	defer s.Close()
+
+	// Execute
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+	reqSet := NewOrderedRequestSet().
+		AddRequest(NewRequest("unix", MethodGet, "unix://"+url.PathEscape(p)+"/containers/json").SetQuery(map[string]string{"all": "1"})).
+		AddRequest(NewRequest("http+unix", MethodGet, "http+unix://"+url.PathEscape(p)+"/info")).
+		AddRequest(NewRequest("missing", MethodGet, "unix://"+url.PathEscape(filepath.Join(dir, "missing.sock"))))
+	assert.NoError(t, reqSet.Validate())
+	respSet := NewGozzle().Exec(reqSet)
+
+	// Assert
+	b, e := respSet.GetResponse("unix").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "unix /containers/json?all=1", string(b))
+	b, e = respSet.GetResponse("http+unix").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "unix /info", string(b))
+	assert.Len(t, respSet.GetResponse("missing").Errors(), 1)
+
+	// Invalid
+	e = NewRequestSet().AddRequest(NewRequest("invalid", MethodGet, "unix:///path")).Validate()
+	assert.True(t, errors.Is(e, ErrInvalidURL))
+}
+
+func TestExecUnixSocketCircuitBreaker(t *testing.T) {
+	// Create server
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "gozzle.sock")
+	l, e := net.Listen("unix", p)
+	assert.NoError(t, e)
+	s := &httptest.Server{Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}, Listener: l}
+	s.Start()
+	defer s.Close()
+
+	// Create gozzle
+	var keys []string
+	g := NewGozzleFromConfiguration(Configuration{
+		CircuitBreaker: CircuitBreakerConfiguration{FailureThreshold: 1, CoolDown: Duration(time.Minute)},
+	}).SetCircuitBreakerHandler(func(key string, from, to CircuitState) { keys = append(keys, key) })
+
+	// A failing socket doesn't open the circuit of other sockets
+	m := filepath.Join(dir, "missing.sock")
+	assert.Len(t, g.Exec(NewRequestSet().AddRequest(NewRequest("missing", MethodGet, "unix://"+url.PathEscape(m)))).GetResponse("missing").Errors(), 1)
+	assert.Equal(t, []string{m}, keys)
+	resp := g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, "unix://"+url.PathEscape(p)))).GetResponse("test")
+	assert.Empty(t, resp.Errors())
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+}
+
+func TestExecDialConfiguration(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(h))
+	}))
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	ns := newTestNameserver(t)
+	defer ns.Close()
+	exec := func(g Gozzle, host string) Response {
+		return g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, "http://"+net.JoinHostPort(host, port)))).GetResponse("test")
+	}
+
+	// Hosts and source IP
+	g := NewGozzle().SetDialConfiguration(DialConfiguration{
+		Hosts:    map[string]string{"Service.test": "127.0.0.1"},
+		SourceIP: "127.0.0.2",
+	})
+	resp := exec(g, "service.test")
+	assert.Empty(t, resp.Errors())
+	b, e := resp.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "127.0.0.2", string(b))
+
+	// Nameservers
+	g.SetDialConfiguration(DialConfiguration{Nameservers: []string{ns.LocalAddr().String()}})
+	resp = exec(g, "resolved.test")
+	assert.Empty(t, resp.Errors())
+	b, e = resp.Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "127.0.0.1", string(b))
+
+	// Invalid
+	g.SetDialConfiguration(DialConfiguration{SourceIP: "invalid"})
+	resp = exec(g, "127.0.0.1")
+	assert.Len(t, resp.Errors(), 1)
+	assert.True(t, errors.Is(resp.Errors()[0], ErrInvalidSourceIP))
+	g.SetDialConfiguration(DialConfiguration{})
+	assert.Empty(t, exec(g, "127.0.0.1").Errors())
+}
+
+func TestNewGozzleFromConfigurationDial(t *testing.T) {
+	c := DialConfiguration{SourceIP: "127.0.0.1"}
+	assert.Equal(t, c, NewGozzleFromConfiguration(Configuration{Dial: c}).DialConfiguration())
+}
@@ -0,0 +1,41 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration represents a JSON-friendly time.Duration
+// It is marshaled as a string such as "1.5s" and can be unmarshaled from either a string or a number of nanoseconds
+type Duration time.Duration
+
+// MarshalJSON implements the json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(b []byte) (e error) {
+	// Number
+	var n int64
+	if e = json.Unmarshal(b, &n); e == nil {
+		*d = Duration(n)
+		return
+	}
+
+	// String
+	var s string
+	if e = json.Unmarshal(b, &s); e != nil {
+		return
+	}
+	var v time.Duration
+	if v, e = time.ParseDuration(s); e != nil {
+		return
+	}
+	*d = Duration(v)
+	return
+}
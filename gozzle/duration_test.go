@@ -0,0 +1,35 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	// Initialize
+	var s struct {
+		A Duration `json:"a"`
+		B Duration `json:"b"`
+	}
+
+	// Unmarshal
+	e := json.Unmarshal([]byte("{\"a\":\"1.5s\",\"b\":1000}"), &s)
+	assert.NoError(t, e)
+	assert.Equal(t, Duration(1500*time.Millisecond), s.A)
+	assert.Equal(t, Duration(time.Microsecond), s.B)
+
+	// Marshal
+	b, e := json.Marshal(s)
+	assert.NoError(t, e)
+	assert.Equal(t, "{\"a\":\"1.5s\",\"b\":\"1µs\"}", string(b))
+
+	// Invalid
+	assert.Error(t, json.Unmarshal([]byte("{\"a\":\"test\"}"), &s))
+}
@@ -0,0 +1,175 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Variables
+var (
+	ErrDestinationBlocked = errors.New("Destination blocked")
+	ErrInvalidCIDR        = errors.New("Invalid CIDR")
+	blockedNetworks       = mustParseCIDRs(
+		// IPv4
+		"0.0.0.0/8",      // Current network
+		"10.0.0.0/8",     // Private
+		"100.64.0.0/10",  // Carrier-grade NAT, including some cloud metadata services
+		"127.0.0.0/8",    // Loopback
+		"169.254.0.0/16", // Link-local, including most cloud metadata services
+		"172.16.0.0/12",  // Private
+		"192.0.0.0/24",   // IETF protocol assignments
+		"192.168.0.0/16", // Private
+		"198.18.0.0/15",  // Benchmarking
+		"224.0.0.0/4",    // Multicast
+		"240.0.0.0/4",    // Reserved and broadcast
+		// IPv6
+		"::/128",       // Unspecified
+		"::1/128",      // Loopback
+		"64:ff9b::/96", // IPv4/IPv6 translation
+		"fc00::/7",     // Unique local, including some cloud metadata services
+		"fe80::/10",    // Link-local
+		"ff00::/8",     // Multicast
+	)
+)
+
+// EgressPolicy represents a JSON-friendly policy restricting the destinations requests can be sent to
+// Destinations are checked once resolved, right before connecting, so that redirects and DNS rebinding can't get
+// around the policy. A destination is blocked if its IP is in DenyCIDRs or its host matches DenyHosts. Otherwise it's
+// allowed if its IP is in AllowCIDRs or its host matches AllowHosts, and blocked if its IP is private, loopback,
+// link-local, multicast or reserved, such as 169.254.169.254. Hosts use the same patterns as proxy rules. When a
+// proxy is used, both the proxy and the destination are checked, the destination being resolved by gozzle before
+// the request goes through the proxy. Requests targeting Unix domain sockets are blocked.
+type EgressPolicy struct {
+	AllowCIDRs []string `json:"allow_cidrs"`
+	AllowHosts []string `json:"allow_hosts"`
+	DenyCIDRs  []string `json:"deny_cidrs"`
+	DenyHosts  []string `json:"deny_hosts"`
+}
+
+type egress struct {
+	allowHosts    []string
+	allowNetworks []*net.IPNet
+	denyHosts     []string
+	denyNetworks  []*net.IPNet
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ns, e := parseCIDRs(cidrs)
+	if e != nil {
+		panic(e)
+	}
+	return ns
+}
+
+func parseCIDRs(cidrs []string) (ns []*net.IPNet, e error) {
+	for _, c := range cidrs {
+		// Single IP
+		s := c
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		// Parse
+		_, n, e := net.ParseCIDR(s)
+		if e != nil {
+			return nil, fmt.Errorf("%w %q", ErrInvalidCIDR, c)
+		}
+		ns = append(ns, n)
+	}
+	return
+}
+
+func lowerHosts(hs []string) (o []string) {
+	for _, h := range hs {
+		o = append(o, strings.ToLower(h))
+	}
+	return
+}
+
+// newEgress parses the egress policy
+func newEgress(p EgressPolicy) (g *egress, e error) {
+	g = &egress{
+		allowHosts: lowerHosts(p.AllowHosts),
+		denyHosts:  lowerHosts(p.DenyHosts),
+	}
+	if g.allowNetworks, e = parseCIDRs(p.AllowCIDRs); e != nil {
+		return nil, e
+	}
+	if g.denyNetworks, e = parseCIDRs(p.DenyCIDRs); e != nil {
+		return nil, e
+	}
+	return
+}
+
+// check checks whether connecting to the IP resolved for the host is allowed
+func (g *egress) check(host string, ip net.IP) error {
+	// Deny
+	host = strings.ToLower(host)
+	if containsIP(g.denyNetworks, ip) || matchHosts(g.denyHosts, host) {
+		return fmt.Errorf("%w: %s (%s)", ErrDestinationBlocked, host, ip)
+	}
+
+	// Allow
+	if containsIP(g.allowNetworks, ip) || matchHosts(g.allowHosts, host) {
+		return nil
+	}
+
+	// Default
+	if ip == nil || containsIP(blockedNetworks, ip) {
+		return fmt.Errorf("%w: %s (%s)", ErrDestinationBlocked, host, ip)
+	}
+	return nil
+}
+
+func containsIP(ns []*net.IPNet, ip net.IP) bool {
+	for _, n := range ns {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHosts(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if matchHost(p, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// control returns the function checking the address right before connecting to it
+func (g *egress) control(host string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		ip, _, e := net.SplitHostPort(address)
+		if e != nil {
+			return fmt.Errorf("%w: %s", ErrDestinationBlocked, address)
+		}
+		return g.check(host, net.ParseIP(ip))
+	}
+}
+
+// SetEgressPolicy sets the policy restricting the destinations requests can be sent to
+// A nil policy, which is the default, allows every destination. If the policy is invalid, requests fail with the
+// error until a valid policy is set.
+func (g *gozzle) SetEgressPolicy(p *EgressPolicy) Gozzle {
+	g.egressPolicy = p
+	return g.SetDialConfiguration(g.dialConfiguration)
+}
+
+// EgressPolicy returns the policy restricting the destinations requests can be sent to
+func (g *gozzle) EgressPolicy() *EgressPolicy {
+	return g.egressPolicy
+}
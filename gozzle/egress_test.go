@@ -0,0 +1,188 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressCheck(t *testing.T) {
+	g, e := newEgress(EgressPolicy{})
+	assert.NoError(t, e)
+	for ip, blocked := range map[string]bool{
+		"10.1.2.3":         true,
+		"100.100.100.200":  true,
+		"127.0.0.1":        true,
+		"169.254.169.254":  true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"0.0.0.0":          true,
+		"::1":              true,
+		"::ffff:127.0.0.1": true,
+		"fd00:ec2::254":    true,
+		"fe80::1":          true,
+		"8.8.8.8":          false,
+		"2001:4860::8888":  false,
+	} {
+		assert.Equal(t, blocked, errors.Is(g.check("host", net.ParseIP(ip)), ErrDestinationBlocked), ip)
+	}
+	assert.True(t, errors.Is(g.check("host", nil), ErrDestinationBlocked))
+
+	// Lists
+	g, e = newEgress(EgressPolicy{
+		AllowCIDRs: []string{"10.0.0.0/8"},
+		AllowHosts: []string{"*.Internal.test"},
+		DenyCIDRs:  []string{"8.8.8.8", "10.0.0.1"},
+		DenyHosts:  []string{"blocked.internal.test"},
+	})
+	assert.NoError(t, e)
+	assert.NoError(t, g.check("host", net.ParseIP("10.1.2.3")))
+	assert.NoError(t, g.check("api.internal.test", net.ParseIP("127.0.0.1")))
+	assert.Error(t, g.check("blocked.internal.test", net.ParseIP("1.1.1.1")))
+	assert.Error(t, g.check("host", net.ParseIP("10.0.0.1")))
+	assert.Error(t, g.check("host", net.ParseIP("8.8.8.8")))
+	assert.NoError(t, g.check("host", net.ParseIP("8.8.4.4")))
+
+	// Invalid
+	_, e = newEgress(EgressPolicy{DenyCIDRs: []string{"invalid"}})
+	assert.True(t, errors.Is(e, ErrInvalidCIDR))
+}
+
+func TestExecEgressPolicy(t *testing.T) {
+	// Initialize
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, s.URL, http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	ns := newTestNameserver(t)
+	defer ns.Close()
+	exec := func(g Gozzle, u string) error {
+		resp := g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, u))).GetResponse("test")
+		if len(resp.Errors()) > 0 {
+			return resp.Errors()[0]
+		}
+		return nil
+	}
+	g := NewGozzle().SetDialConfiguration(DialConfiguration{
+		Hosts:       map[string]string{"allowed.test": "127.0.0.1"},
+		Nameservers: []string{ns.LocalAddr().String()},
+	})
+
+	// No policy
+	assert.NoError(t, exec(g, s.URL))
+
+	// Loopback
+	g.SetEgressPolicy(&EgressPolicy{AllowHosts: []string{"allowed.test"}})
+	assert.True(t, errors.Is(exec(g, s.URL), ErrDestinationBlocked))
+
+	// DNS rebinding
+	assert.True(t, errors.Is(exec(g, "http://"+net.JoinHostPort("rebind.test", port)), ErrDestinationBlocked))
+
+	// Redirect
+	allowed := "http://" + net.JoinHostPort("allowed.test", port)
+	assert.NoError(t, exec(g, allowed))
+	assert.True(t, errors.Is(exec(g, allowed+"/redirect"), ErrDestinationBlocked))
+
+	// Allowed CIDR
+	g.SetEgressPolicy(&EgressPolicy{AllowCIDRs: []string{"127.0.0.0/8"}})
+	assert.NoError(t, exec(g, s.URL))
+	assert.NoError(t, exec(g, allowed+"/redirect"))
+
+	// Denied host
+	g.SetEgressPolicy(&EgressPolicy{AllowCIDRs: []string{"127.0.0.0/8"}, DenyHosts: []string{"allowed.test"}})
+	assert.True(t, errors.Is(exec(g, allowed), ErrDestinationBlocked))
+
+	// Unix socket
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	assert.True(t, errors.Is(exec(g, "unix://"+url.PathEscape(filepath.Join(dir, "gozzle.sock"))), ErrDestinationBlocked))
+
+	// Invalid
+	g.SetEgressPolicy(&EgressPolicy{AllowCIDRs: []string{"invalid"}})
+	assert.True(t, errors.Is(exec(g, s.URL), ErrInvalidCIDR))
+	g.SetEgressPolicy(nil)
+	assert.NoError(t, exec(g, s.URL))
+}
+
+func TestExecEgressPolicyProxy(t *testing.T) {
+	// Initialize
+	p := newTestProxy("")
+	defer p.Close()
+	_, port, _ := net.SplitHostPort(p.Listener.Addr().String())
+	proxyURL := "http://" + net.JoinHostPort("proxy.test", port)
+	ns := newTestNameserver(t)
+	defer ns.Close()
+	g := NewGozzle().
+		SetDialConfiguration(DialConfiguration{
+			Hosts:       map[string]string{"proxy.test": "127.0.0.1"},
+			Nameservers: []string{ns.LocalAddr().String()},
+		}).
+		SetEgressPolicy(&EgressPolicy{AllowHosts: []string{"allowed.test", "proxy.test"}})
+	exec := func(u string, c *ProxyConfiguration) (string, error) {
+		resp := g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, u).SetProxy(c))).GetResponse("test")
+		if len(resp.Errors()) > 0 {
+			return "", resp.Errors()[0]
+		}
+		b, e := resp.Body()
+		return string(b), e
+	}
+
+	for _, c := range []struct {
+		name  string
+		proxy func() *ProxyConfiguration
+	}{
+		{name: "environment", proxy: func() *ProxyConfiguration {
+			t.Setenv("HTTP_PROXY", proxyURL)
+			return &ProxyConfiguration{Environment: true}
+		}},
+		{name: "configured", proxy: func() *ProxyConfiguration {
+			return &ProxyConfiguration{URL: proxyURL}
+		}},
+	} {
+		g.SetProxyConfiguration(c.proxy())
+
+		// Allowed
+		b, e := exec("http://allowed.test/path", nil)
+		assert.NoError(t, e, c.name)
+		assert.Equal(t, "http proxy: http://allowed.test/path", b, c.name)
+
+		// Metadata IP
+		_, e = exec("http://169.254.169.254/latest/meta-data/", nil)
+		assert.True(t, errors.Is(e, ErrDestinationBlocked), c.name)
+
+		// Resolved host
+		_, e = exec("http://internal.test/", nil)
+		assert.True(t, errors.Is(e, ErrDestinationBlocked), c.name)
+
+		// Request proxy
+		_, e = exec("http://169.254.169.254/", &ProxyConfiguration{URL: proxyURL})
+		assert.True(t, errors.Is(e, ErrDestinationBlocked), c.name)
+	}
+}
+
+func TestNewGozzleFromConfigurationEgress(t *testing.T) {
+	p := &EgressPolicy{DenyHosts: []string{"metadata.google.internal"}}
+	g := NewGozzleFromConfiguration(Configuration{Egress: p})
+	assert.Equal(t, p, g.EgressPolicy())
+	resp := g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, "http://127.0.0.1:1"))).GetResponse("test")
+	assert.True(t, errors.Is(resp.Errors()[0], ErrDestinationBlocked))
+}
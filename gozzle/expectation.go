@@ -0,0 +1,348 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Variables
+var (
+	ErrJSONPathNotFound = errors.New("JSON path not found")
+)
+
+// Expectation represents a check performed on a response once its request has been executed
+type Expectation interface {
+	// Check returns an error describing why the response doesn't meet the expectation
+	Check(resp Response) error
+	// String returns a description of the expectation
+	String() string
+}
+
+// ExpectationResult represents the result of an expectation
+type ExpectationResult struct {
+	Error       error
+	Expectation string
+	Name        string
+}
+
+// Passed returns whether the response has met the expectation
+func (r ExpectationResult) Passed() bool {
+	return r.Error == nil
+}
+
+// ExpectationReport represents the results of the expectations of a response set
+type ExpectationReport []ExpectationResult
+
+// Failures returns the results of the expectations that have not been met
+func (r ExpectationReport) Failures() (f ExpectationReport) {
+	for _, v := range r {
+		if !v.Passed() {
+			f = append(f, v)
+		}
+	}
+	return
+}
+
+// Passed returns whether all expectations have been met
+func (r ExpectationReport) Passed() bool {
+	return len(r.Failures()) == 0
+}
+
+// String returns a human-readable report with one line per expectation
+func (r ExpectationReport) String() string {
+	var ss []string
+	for _, v := range r {
+		if v.Passed() {
+			ss = append(ss, fmt.Sprintf("PASS %s: %s", v.Name, v.Expectation))
+		} else {
+			ss = append(ss, fmt.Sprintf("FAIL %s: %s: %s", v.Name, v.Expectation, v.Error))
+		}
+	}
+	return strings.Join(ss, "\n")
+}
+
+// checkExpectations checks the expectations of the request against the response
+func checkExpectations(req Request, resp Response) (rs []ExpectationResult) {
+	for _, e := range req.Expectations() {
+		rs = append(rs, ExpectationResult{
+			Error:       e.Check(resp),
+			Expectation: e.String(),
+			Name:        req.Name(),
+		})
+	}
+	return
+}
+
+type expectation struct {
+	check       func(resp Response) error
+	description string
+}
+
+// Check implements the Expectation interface
+func (e expectation) Check(resp Response) error {
+	return e.check(resp)
+}
+
+// String implements the Expectation interface
+func (e expectation) String() string {
+	return e.description
+}
+
+// ExpectStatus creates an expectation checking the response status code is one of the provided codes
+// It doesn't change the success policy which may need to be updated as well.
+func ExpectStatus(codes ...int) Expectation {
+	return expectation{
+		check: func(resp Response) error {
+			for _, c := range codes {
+				if resp.StatusCode() == c {
+					return nil
+				}
+			}
+			return fmt.Errorf("got status %d", resp.StatusCode())
+		},
+		description: fmt.Sprintf("status in %v", codes),
+	}
+}
+
+// ExpectHeader creates an expectation checking the response header equals the provided value
+func ExpectHeader(key, value string) Expectation {
+	return expectation{
+		check: func(resp Response) error {
+			if v := resp.Header().Get(key); v != value {
+				return fmt.Errorf("got %q", v)
+			}
+			return nil
+		},
+		description: fmt.Sprintf("header %s == %q", key, value),
+	}
+}
+
+// ExpectHeaderMatch creates an expectation checking the response header matches the provided regular expression
+func ExpectHeaderMatch(key, pattern string) Expectation {
+	re, err := regexp.Compile(pattern)
+	return expectation{
+		check: func(resp Response) error {
+			if err != nil {
+				return err
+			}
+			if v := resp.Header().Get(key); !re.MatchString(v) {
+				return fmt.Errorf("got %q", v)
+			}
+			return nil
+		},
+		description: fmt.Sprintf("header %s matches %q", key, pattern),
+	}
+}
+
+// ExpectJSONPath creates an expectation checking the value at the JSON path of the response body equals the provided
+// value once encoded to JSON
+func ExpectJSONPath(path string, value interface{}) Expectation {
+	return expectation{
+		check: func(resp Response) error {
+			// Normalize expected value
+			b, e := json.Marshal(value)
+			if e != nil {
+				return e
+			}
+			ev, e := decodeJSON(b)
+			if e != nil {
+				return e
+			}
+
+			// Get value
+			v, e := responseJSONPath(resp, path)
+			if e != nil {
+				return e
+			}
+
+			// Compare
+			if !equalJSON(ev, v) {
+				return fmt.Errorf("got %s", formatJSONValue(v))
+			}
+			return nil
+		},
+		description: fmt.Sprintf("%s == %s", path, formatJSONValue(value)),
+	}
+}
+
+// ExpectJSONPathMatch creates an expectation checking the value at the JSON path of the response body matches the
+// provided regular expression. Values that are not strings are encoded to JSON first.
+func ExpectJSONPathMatch(path, pattern string) Expectation {
+	re, err := regexp.Compile(pattern)
+	return expectation{
+		check: func(resp Response) error {
+			// Invalid pattern
+			if err != nil {
+				return err
+			}
+
+			// Get value
+			v, e := responseJSONPath(resp, path)
+			if e != nil {
+				return e
+			}
+
+			// Match
+			s, ok := v.(string)
+			if !ok {
+				s = formatJSONValue(v)
+			}
+			if !re.MatchString(s) {
+				return fmt.Errorf("got %s", formatJSONValue(v))
+			}
+			return nil
+		},
+		description: fmt.Sprintf("%s matches %q", path, pattern),
+	}
+}
+
+// ExpectJSONSchema creates an expectation validating the response body against the provided JSON Schema
+func ExpectJSONSchema(schema string) Expectation {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	return expectation{
+		check: func(resp Response) error {
+			// Invalid schema
+			if err != nil {
+				return fmt.Errorf("Invalid JSON schema: %w", err)
+			}
+
+			// Read body
+			b, e := resp.Body()
+			if e != nil {
+				return e
+			}
+
+			// Validate
+			r, e := s.Validate(gojsonschema.NewBytesLoader(b))
+			if e != nil {
+				return e
+			}
+			if !r.Valid() {
+				var ss []string
+				for _, v := range r.Errors() {
+					ss = append(ss, v.String())
+				}
+				return errors.New(strings.Join(ss, "; "))
+			}
+			return nil
+		},
+		description: "body matches JSON schema",
+	}
+}
+
+// ExpectMaxLatency creates an expectation checking the response headers have been received within the provided
+// duration
+func ExpectMaxLatency(d time.Duration) Expectation {
+	return expectation{
+		check: func(resp Response) error {
+			if l := resp.Timing().Duration; l > d {
+				return fmt.Errorf("got %s", l)
+			}
+			return nil
+		},
+		description: fmt.Sprintf("latency <= %s", d),
+	}
+}
+
+func responseJSONPath(resp Response, path string) (interface{}, error) {
+	// Read body
+	b, e := resp.Body()
+	if e != nil {
+		return nil, e
+	}
+
+	// Decode body
+	d, e := decodeJSON(b)
+	if e != nil {
+		return nil, e
+	}
+
+	// Get value
+	v, ok := jsonPath(d, path)
+	if !ok {
+		return nil, ErrJSONPathNotFound
+	}
+	return v, nil
+}
+
+func formatJSONValue(v interface{}) string {
+	b, e := json.Marshal(v)
+	if e != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// ExpectationDefinition represents a JSON/YAML-friendly definition of the expectations of a request
+// JSONSchema is either a schema object or a string containing the schema.
+type ExpectationDefinition struct {
+	Headers      map[string]string      `json:"headers,omitempty"`
+	HeadersMatch map[string]string      `json:"headers_match,omitempty"`
+	JSON         map[string]interface{} `json:"json,omitempty"`
+	JSONMatch    map[string]string      `json:"json_match,omitempty"`
+	JSONSchema   interface{}            `json:"json_schema,omitempty"`
+	MaxLatency   Duration               `json:"max_latency,omitempty"`
+	Status       []int                  `json:"status,omitempty"`
+}
+
+// Expectations creates the expectations described by the definition
+func (d ExpectationDefinition) Expectations() (es []Expectation) {
+	// Status
+	if len(d.Status) > 0 {
+		es = append(es, ExpectStatus(d.Status...))
+	}
+
+	// Headers
+	for _, k := range sortedKeys(d.Headers) {
+		es = append(es, ExpectHeader(k, d.Headers[k]))
+	}
+	for _, k := range sortedKeys(d.HeadersMatch) {
+		es = append(es, ExpectHeaderMatch(k, d.HeadersMatch[k]))
+	}
+
+	// JSON
+	var ks []string
+	for k := range d.JSON {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		es = append(es, ExpectJSONPath(k, d.JSON[k]))
+	}
+	for _, k := range sortedKeys(d.JSONMatch) {
+		es = append(es, ExpectJSONPathMatch(k, d.JSONMatch[k]))
+	}
+	if d.JSONSchema != nil {
+		s, ok := d.JSONSchema.(string)
+		if !ok {
+			b, _ := json.Marshal(d.JSONSchema)
+			s = string(b)
+		}
+		es = append(es, ExpectJSONSchema(s))
+	}
+
+	// Latency
+	if d.MaxLatency > 0 {
+		es = append(es, ExpectMaxLatency(time.Duration(d.MaxLatency)))
+	}
+	return
+}
+
+func sortedKeys(m map[string]string) (ks []string) {
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return
+}
@@ -0,0 +1,167 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testJSONSchema = `{
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+}`
+
+func TestExpectations(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"id":1,"name":"gozzle","tags":["a","b"]}`))
+	}))
+	defer s.Close()
+	var afterHandlerResults []ExpectationResult
+	var afterHandlerBody []byte
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("pass", MethodGet, s.URL).AddExpectation(
+		ExpectStatus(http.StatusOK),
+		ExpectHeader("Content-Type", "application/json; charset=utf-8"),
+		ExpectHeaderMatch("Content-Type", "^application/json"),
+		ExpectJSONPath("$.id", 1),
+		ExpectJSONPath("$.tags", []string{"a", "b"}),
+		ExpectJSONPathMatch("$.name", "^goz"),
+		ExpectJSONPathMatch("$.id", "^[0-9]+$"),
+		ExpectJSONSchema(testJSONSchema),
+		ExpectMaxLatency(time.Minute),
+	).SetAfterHandler(func(req Request, resp Response) {
+		afterHandlerResults = resp.Expectations()
+		afterHandlerBody, _ = resp.Body()
+	}))
+	reqSet.AddRequest(NewRequest("fail", MethodGet, s.URL).AddExpectation(
+		ExpectStatus(http.StatusCreated),
+		ExpectHeader("Content-Type", "text/plain"),
+		ExpectHeaderMatch("Content-Type", "("),
+		ExpectJSONPath("$.id", 2),
+		ExpectJSONPath("$.missing", 2),
+		ExpectJSONPathMatch("$.name", "^x"),
+		ExpectJSONSchema(`{"type": "array"}`),
+		ExpectJSONSchema(`{`),
+		ExpectMaxLatency(0),
+	))
+	reqSet.AddRequest(NewRequest("none", MethodGet, s.URL))
+
+	// Execute
+	respSet := NewGozzle().Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert passing expectations
+	assert.Len(t, afterHandlerResults, 9)
+	assert.Equal(t, `{"id":1,"name":"gozzle","tags":["a","b"]}`, string(afterHandlerBody))
+	for _, r := range respSet.GetResponse("pass").Expectations() {
+		assert.True(t, r.Passed(), r.Expectation)
+		assert.Equal(t, "pass", r.Name)
+	}
+
+	// Assert failing expectations
+	rs := respSet.GetResponse("fail").Expectations()
+	assert.Len(t, rs, 9)
+	for _, r := range rs {
+		assert.False(t, r.Passed(), r.Expectation)
+	}
+	assert.Equal(t, "status in [201]", rs[0].Expectation)
+	assert.EqualError(t, rs[0].Error, "got status 200")
+	assert.EqualError(t, rs[1].Error, `got "application/json; charset=utf-8"`)
+	assert.Equal(t, "$.id == 2", rs[3].Expectation)
+	assert.EqualError(t, rs[3].Error, "got 1")
+	assert.Equal(t, ErrJSONPathNotFound, rs[4].Error)
+	assert.EqualError(t, rs[5].Error, `got "gozzle"`)
+	assert.Contains(t, rs[6].Error.Error(), "Invalid type. Expected: array, given: object")
+	assert.Contains(t, rs[7].Error.Error(), "Invalid JSON schema")
+	assert.Equal(t, "latency <= 0s", rs[8].Expectation)
+
+	// Assert report
+	r := respSet.Report()
+	assert.Len(t, r, 18)
+	assert.False(t, r.Passed())
+	assert.Len(t, r.Failures(), 9)
+	assert.Equal(t, "fail", r[0].Name)
+	assert.Equal(t, "pass", r[9].Name)
+	assert.Contains(t, r.String(), "FAIL fail: status in [201]: got status 200\n")
+	assert.Contains(t, r.String(), "PASS pass: status in [200]")
+	assert.True(t, r[9:].Passed())
+}
+
+func TestExpectationsResponseError(t *testing.T) {
+	// Execute
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("test", MethodGet, "test").AddExpectation(ExpectStatus(http.StatusOK), ExpectJSONPath("$", nil)))
+	respSet := NewGozzle().Exec(reqSet)
+
+	// Assert
+	rs := respSet.GetResponse("test").Expectations()
+	assert.Len(t, rs, 2)
+	assert.EqualError(t, rs[0].Error, "got status 0")
+	assert.False(t, rs[1].Passed())
+}
+
+func TestExpectationDefinition(t *testing.T) {
+	// Parse
+	d, e := ParseRequestSetDefinition([]byte(`requests:
+  - name: test
+    path: /test
+    expect:
+      status: [200, 404]
+      headers:
+        Content-Type: application/json
+      headers_match:
+        X-Id: "^[0-9]+$"
+      json:
+        $.id: 1
+        $.name: gozzle
+      json_match:
+        $.name: ^goz
+      json_schema:
+        type: object
+      max_latency: 500ms
+`), nil)
+	assert.NoError(t, e)
+
+	// Assert
+	r := d.Requests[0].Request()
+	var ss []string
+	for _, e := range r.Expectations() {
+		ss = append(ss, e.String())
+	}
+	assert.Equal(t, []string{
+		"status in [200 404]",
+		`header Content-Type == "application/json"`,
+		`header X-Id matches "^[0-9]+$"`,
+		"$.id == 1",
+		`$.name == "gozzle"`,
+		`$.name matches "^goz"`,
+		"body matches JSON schema",
+		"latency <= 500ms",
+	}, ss)
+	assert.NotNil(t, r.SuccessPolicy())
+
+	// Errors
+	_, e = ParseRequestSetDefinition([]byte(`requests:
+  - name: test
+    path: /test
+    expect:
+      status: 200
+      unknown: true
+      json: []
+      max_latency: test
+`), nil)
+	assert.EqualError(t, e, `line 6: requests[0].expect: unknown key "unknown"
+line 5: requests[0].expect: status must be an array
+line 7: requests[0].expect.json must be an object
+line 8: requests[0].expect: invalid max_latency "test"`)
+}
@@ -0,0 +1,169 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/antchfx/xmlquery"
+)
+
+// Variables
+var (
+	ErrNoMatch = errors.New("No match")
+)
+
+// Extractor represents a rule extracting a variable from a response
+// Extracted variables can be referenced by the other requests of the request set with {{name}} templates.
+type Extractor interface {
+	// Extract returns the value of the variable
+	Extract(resp Response) (string, error)
+	// Variable returns the name of the variable
+	Variable() string
+}
+
+type extractor struct {
+	extract  func(resp Response) (string, error)
+	variable string
+}
+
+// Extract implements the Extractor interface
+func (e extractor) Extract(resp Response) (string, error) {
+	return e.extract(resp)
+}
+
+// Variable implements the Extractor interface
+func (e extractor) Variable() string {
+	return e.variable
+}
+
+// ExtractHeader creates an extractor reading the variable from the response header
+func ExtractHeader(variable, key string) Extractor {
+	return extractor{
+		extract: func(resp Response) (string, error) {
+			if vs := resp.Header().Values(key); len(vs) > 0 {
+				return vs[0], nil
+			}
+			return "", ErrNoMatch
+		},
+		variable: variable,
+	}
+}
+
+// ExtractJSONPath creates an extractor reading the variable at the JSON path of the response body
+// Values that are not strings are encoded to JSON.
+func ExtractJSONPath(variable, path string) Extractor {
+	return extractor{
+		extract: func(resp Response) (string, error) {
+			v, e := responseJSONPath(resp, path)
+			if e != nil {
+				return "", e
+			}
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return formatJSONValue(v), nil
+		},
+		variable: variable,
+	}
+}
+
+// ExtractRegexp creates an extractor reading the variable in the response body with a regular expression
+// The variable is the first submatch if the regular expression has one and the whole match otherwise.
+func ExtractRegexp(variable, pattern string) Extractor {
+	re, err := regexp.Compile(pattern)
+	return extractor{
+		extract: func(resp Response) (string, error) {
+			// Invalid pattern
+			if err != nil {
+				return "", err
+			}
+
+			// Read body
+			b, e := resp.Body()
+			if e != nil {
+				return "", e
+			}
+
+			// Match
+			m := re.FindSubmatch(b)
+			if m == nil {
+				return "", ErrNoMatch
+			} else if len(m) > 1 {
+				return string(m[1]), nil
+			}
+			return string(m[0]), nil
+		},
+		variable: variable,
+	}
+}
+
+// ExtractXPath creates an extractor reading the variable in the XML response body with an XPath expression
+// The variable is the inner text of the first matching node.
+func ExtractXPath(variable, expr string) Extractor {
+	return extractor{
+		extract: func(resp Response) (string, error) {
+			// Read body
+			b, e := resp.Body()
+			if e != nil {
+				return "", e
+			}
+
+			// Parse body
+			doc, e := xmlquery.Parse(bytes.NewReader(b))
+			if e != nil {
+				return "", e
+			}
+
+			// Query
+			n, e := xmlquery.Query(doc, expr)
+			if e != nil {
+				return "", e
+			} else if n == nil {
+				return "", ErrNoMatch
+			}
+			return n.InnerText(), nil
+		},
+		variable: variable,
+	}
+}
+
+// extract extracts the variables of the request from the response
+func (r *response) extract(req Request, vs *variables) {
+	for _, x := range req.Extractors() {
+		v, e := x.Extract(r)
+		if e != nil {
+			r.addError(fmt.Errorf("Extracting variable %s failed: %w", x.Variable(), e))
+			continue
+		}
+		vs.set(x.Variable(), v)
+	}
+}
+
+// ExtractionDefinition represents a JSON/YAML-friendly definition of an extractor
+// Exactly one of Header, JSON, Regexp and XPath must be set.
+type ExtractionDefinition struct {
+	Header string `json:"header,omitempty"`
+	JSON   string `json:"json,omitempty"`
+	Regexp string `json:"regexp,omitempty"`
+	XPath  string `json:"xpath,omitempty"`
+}
+
+// Extractor creates the extractor described by the definition
+func (d ExtractionDefinition) Extractor(variable string) Extractor {
+	switch {
+	case d.Header != "":
+		return ExtractHeader(variable, d.Header)
+	case d.Regexp != "":
+		return ExtractRegexp(variable, d.Regexp)
+	case d.XPath != "":
+		return ExtractXPath(variable, d.XPath)
+	default:
+		return ExtractJSONPath(variable, d.JSON)
+	}
+}
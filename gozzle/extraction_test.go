@@ -0,0 +1,112 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResponse(header http.Header, body string) Response {
+	return NewResponse(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Header:     header,
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+	}, 0)
+}
+
+func TestExtractors(t *testing.T) {
+	// Header
+	resp := newTestResponse(http.Header{"X-Token": []string{"token"}}, "")
+	v, e := ExtractHeader("token", "x-token").Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "token", v)
+	_, e = ExtractHeader("token", "X-Missing").Extract(resp)
+	assert.Equal(t, ErrNoMatch, e)
+
+	// JSON path
+	resp = newTestResponse(http.Header{}, `{"data":{"token":"token","id":12,"big":9007199254740993,"tags":["a"]}}`)
+	x := ExtractJSONPath("token", "$.data.token")
+	assert.Equal(t, "token", x.Variable())
+	v, e = x.Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "token", v)
+	v, e = ExtractJSONPath("id", "$.data.id").Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "12", v)
+	v, e = ExtractJSONPath("big", "$.data.big").Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "9007199254740993", v)
+	v, e = ExtractJSONPath("tags", "$.data.tags").Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, `["a"]`, v)
+	_, e = ExtractJSONPath("missing", "$.missing").Extract(resp)
+	assert.Equal(t, ErrJSONPathNotFound, e)
+
+	// Regexp
+	resp = newTestResponse(http.Header{}, "id=123; name=gozzle")
+	v, e = ExtractRegexp("id", `id=(\d+)`).Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "123", v)
+	v, e = ExtractRegexp("name", `gozz\w+`).Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "gozzle", v)
+	_, e = ExtractRegexp("missing", `missing`).Extract(resp)
+	assert.Equal(t, ErrNoMatch, e)
+	_, e = ExtractRegexp("invalid", `(`).Extract(resp)
+	assert.Error(t, e)
+
+	// XPath
+	resp = newTestResponse(http.Header{}, `<response><session id="1"><token>token</token></session></response>`)
+	v, e = ExtractXPath("token", "//session/token").Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "token", v)
+	v, e = ExtractXPath("id", "//session/@id").Extract(resp)
+	assert.NoError(t, e)
+	assert.Equal(t, "1", v)
+	_, e = ExtractXPath("missing", "//missing").Extract(resp)
+	assert.Equal(t, ErrNoMatch, e)
+}
+
+func TestExtractionDefinition(t *testing.T) {
+	// Parse
+	d, e := ParseRequestSetDefinition([]byte(`requests:
+  - name: login
+    path: /login
+    extract:
+      token:
+        json: $.token
+      session:
+        header: X-Session
+  - name: user
+    path: /users
+    headers:
+      Authorization: Bearer {{token}}
+`), nil)
+	assert.NoError(t, e)
+
+	// Assert
+	r := d.Requests[0].Request()
+	assert.Len(t, r.Extractors(), 2)
+	assert.Equal(t, "session", r.Extractors()[0].Variable())
+	assert.Equal(t, "token", r.Extractors()[1].Variable())
+	assert.Equal(t, "Bearer {{token}}", d.Requests[1].Request().GetHeader("Authorization"))
+
+	// Errors
+	_, e = ParseRequestSetDefinition([]byte(`requests:
+  - name: test
+    path: /test
+    extract:
+      token:
+        json: $.token
+        header: X-Token
+`), nil)
+	assert.EqualError(t, e, "line 6: requests[0].extract.token: exactly one of header, json, regexp and xpath is required")
+}
@@ -0,0 +1,162 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Variables
+var (
+	ErrFaultConnectionDropped = errors.New("Connection dropped by fault injection")
+	randFloat64               = rand.Float64
+)
+
+// Fault represents a JSON-friendly fault injected into the requests matching its scope
+//
+// Name and Host scope the fault and accept path.Match patterns. An empty scope matches every request.
+// Probability is the chance in [0, 1] the fault is applied to a matching request. When nil, the fault is always
+// applied whereas a probability <= 0 disables it.
+// StatusCode, when set, short-circuits the request with an empty response having this status code.
+// TruncateBody, when > 0, truncates the response body after this number of bytes.
+// ReadDelay, when > 0, is waited before each read of the response body.
+type Fault struct {
+	Name         string   `json:"name"`
+	Host         string   `json:"host"`
+	Probability  *float64 `json:"probability"`
+	Latency      Duration `json:"latency"`
+	StatusCode   int      `json:"status_code"`
+	Drop         bool     `json:"drop"`
+	TruncateBody int      `json:"truncate_body"`
+	ReadDelay    Duration `json:"read_delay"`
+}
+
+// NewFaultInjector creates a middleware injecting the provided faults into the requests matching their scope
+func NewFaultInjector(faults ...Fault) Middleware {
+	return func(next RoundTrip) RoundTrip {
+		return func(req Request, httpReq *http.Request) (*http.Response, error) {
+			// Select faults
+			var fs []Fault
+			for _, f := range faults {
+				if f.matches(req, httpReq) && f.triggers() {
+					fs = append(fs, f)
+				}
+			}
+
+			// No fault
+			if len(fs) == 0 {
+				return next(req, httpReq)
+			}
+
+			// Add latency
+			var l time.Duration
+			for _, f := range fs {
+				l += time.Duration(f.Latency)
+			}
+			if l > 0 {
+				select {
+				case <-time.After(l):
+				case <-httpReq.Context().Done():
+					return nil, httpReq.Context().Err()
+				}
+			}
+
+			// Short-circuit the request
+			for _, f := range fs {
+				if f.Drop {
+					closeRequestBody(httpReq)
+					return nil, ErrFaultConnectionDropped
+				} else if f.StatusCode > 0 {
+					closeRequestBody(httpReq)
+					return faultResponse(httpReq, f.StatusCode), nil
+				}
+			}
+
+			// Send request
+			httpResp, e := next(req, httpReq)
+			if e != nil {
+				return httpResp, e
+			}
+
+			// Alter body
+			for _, f := range fs {
+				if f.TruncateBody > 0 {
+					httpResp.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.LimitReader(httpResp.Body, int64(f.TruncateBody)), httpResp.Body}
+				}
+				if f.ReadDelay > 0 {
+					httpResp.Body = &slowReadCloser{ReadCloser: httpResp.Body, delay: time.Duration(f.ReadDelay)}
+				}
+			}
+			return httpResp, nil
+		}
+	}
+}
+
+func (f Fault) matches(req Request, httpReq *http.Request) bool {
+	// Name
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, req.Name()); !ok {
+			return false
+		}
+	}
+
+	// Host
+	if f.Host != "" {
+		okHost, _ := path.Match(f.Host, httpReq.URL.Host)
+		okHostname, _ := path.Match(f.Host, httpReq.URL.Hostname())
+		if !okHost && !okHostname {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Fault) triggers() bool {
+	if f.Probability == nil || *f.Probability >= 1 {
+		return true
+	}
+	return randFloat64() < *f.Probability
+}
+
+func faultResponse(httpReq *http.Request, statusCode int) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte{})),
+		Request:    httpReq,
+	}
+}
+
+func closeRequestBody(httpReq *http.Request) {
+	if httpReq.Body != nil {
+		httpReq.Body.Close()
+	}
+}
+
+type slowReadCloser struct {
+	io.ReadCloser
+	delay time.Duration
+}
+
+// Read implements the io.Reader interface
+func (r *slowReadCloser) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.ReadCloser.Read(p)
+}
@@ -0,0 +1,94 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjector(t *testing.T) {
+	// Create server
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Write([]byte("testmessage"))
+	}))
+	defer server.Close()
+
+	// Create gozzle
+	g := NewGozzleFromConfiguration(Configuration{Faults: []Fault{
+		{Name: "status", StatusCode: 503},
+		{Name: "drop", Drop: true},
+		{Name: "truncate", TruncateBody: 4},
+		{Name: "latency*", Latency: Duration(50 * time.Millisecond)},
+	}})
+
+	// Create request set
+	reqSet := NewRequestSet()
+	for _, n := range []string{"status", "drop", "truncate", "latency-1", "none"} {
+		reqSet.AddRequest(NewRequest(n, MethodGet, server.URL))
+	}
+
+	// Execute requests
+	s := time.Now()
+	respSet := g.Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.True(t, time.Since(s) >= 50*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&count))
+	assert.Equal(t, 503, respSet.GetResponse("status").StatusCode())
+	assert.Len(t, respSet.GetResponse("drop").Errors(), 1)
+	assert.Equal(t, ErrFaultConnectionDropped, respSet.GetResponse("drop").Errors()[0])
+	b, e := ioutil.ReadAll(respSet.GetResponse("truncate").BodyReader())
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+	b, e = ioutil.ReadAll(respSet.GetResponse("none").BodyReader())
+	assert.NoError(t, e)
+	assert.Equal(t, "testmessage", string(b))
+}
+
+func TestFaultScope(t *testing.T) {
+	// Initialize
+	httpReq, _ := http.NewRequest(MethodGet, "http://example.com:8080/test", nil)
+	req := NewRequest("test", MethodGet, "/test")
+
+	// Assert
+	assert.True(t, Fault{}.matches(req, httpReq))
+	assert.True(t, Fault{Name: "te*"}.matches(req, httpReq))
+	assert.False(t, Fault{Name: "other"}.matches(req, httpReq))
+	assert.True(t, Fault{Host: "example.com"}.matches(req, httpReq))
+	assert.True(t, Fault{Host: "example.com:8080"}.matches(req, httpReq))
+	assert.False(t, Fault{Name: "test", Host: "other.com"}.matches(req, httpReq))
+}
+
+func TestFaultProbability(t *testing.T) {
+	// Mock random
+	defer func(f func() float64) { randFloat64 = f }(randFloat64)
+	randFloat64 = func() float64 { return 0.5 }
+
+	// Assert
+	p := func(v float64) *float64 { return &v }
+	assert.True(t, Fault{}.triggers())
+	assert.True(t, Fault{Probability: p(1)}.triggers())
+	assert.True(t, Fault{Probability: p(0.6)}.triggers())
+	assert.False(t, Fault{Probability: p(0.4)}.triggers())
+	assert.False(t, Fault{Probability: p(0)}.triggers())
+	assert.False(t, Fault{Probability: p(-1)}.triggers())
+
+	// JSON
+	var fs []Fault
+	assert.NoError(t, json.Unmarshal([]byte(`[{"status_code":503},{"status_code":503,"probability":0}]`), &fs))
+	assert.True(t, fs[0].triggers())
+	assert.False(t, fs[1].triggers())
+}
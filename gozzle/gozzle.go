@@ -6,12 +6,16 @@ package gozzle
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // Constants
@@ -30,28 +34,151 @@ type Gozzle interface {
 	Exec(reqSet RequestSet) ResponseSet
 	MaxSizeBody() int
 	SetMaxSizeBody(maxSizeBody int) Gozzle
+	Middlewares() []Middleware
+	AddMiddleware(m Middleware) Gozzle
+	RateLimitConfiguration() RateLimitConfiguration
+	SetRateLimitConfiguration(c RateLimitConfiguration) Gozzle
+	CircuitBreakerConfiguration() CircuitBreakerConfiguration
+	SetCircuitBreakerConfiguration(c CircuitBreakerConfiguration) Gozzle
+	SetCircuitBreakerHandler(h CircuitBreakerHandler) Gozzle
+	SuccessPolicy() SuccessPolicy
+	SetSuccessPolicy(p SuccessPolicy) Gozzle
+	BodyLimitMode() string
+	SetBodyLimitMode(m string) Gozzle
+	Decompression() bool
+	SetDecompression(d bool) Gozzle
+	Compression() *Compression
+	SetCompression(c *Compression) Gozzle
+	Concurrency() int
+	SetConcurrency(n int) Gozzle
+	Timeout() time.Duration
+	SetTimeout(d time.Duration) Gozzle
+	CookieJar() http.CookieJar
+	SetCookieJar(j http.CookieJar) Gozzle
+	CookieJarIsolation() bool
+	SetCookieJarIsolation(i bool) Gozzle
+	RedirectPolicy() *RedirectPolicy
+	SetRedirectPolicy(p *RedirectPolicy) Gozzle
+	TLSConfiguration() TLSConfiguration
+	SetTLSConfiguration(c TLSConfiguration) Gozzle
+	Transport() *http.Transport
+	ProxyConfiguration() *ProxyConfiguration
+	SetProxyConfiguration(c *ProxyConfiguration) Gozzle
+	DialConfiguration() DialConfiguration
+	SetDialConfiguration(c DialConfiguration) Gozzle
+	EgressPolicy() *EgressPolicy
+	SetEgressPolicy(p *EgressPolicy) Gozzle
 }
 
+// RoundTrip represents a function sending the http request built for a gozzle request
+type RoundTrip func(req Request, httpReq *http.Request) (*http.Response, error)
+
+// Middleware represents a function wrapping the round trip of every request executed by gozzle
+type Middleware func(next RoundTrip) RoundTrip
+
 // Configuration represents a JSON-friendly gozzle configuration
 type Configuration struct {
-	MaxSizeBody int `json:"max_size_body"`
+	MaxSizeBody          int                         `json:"max_size_body"`
+	Concurrency          int                         `json:"concurrency"`
+	Timeout              Duration                    `json:"timeout"`
+	BodyLimitMode        string                      `json:"body_limit_mode"`
+	DisableDecompression bool                        `json:"disable_decompression"`
+	Dial                 DialConfiguration           `json:"dial"`
+	Egress               *EgressPolicy               `json:"egress"`
+	Compression          *Compression                `json:"compression"`
+	Cookies              *CookieConfiguration        `json:"cookies"`
+	Proxy                *ProxyConfiguration         `json:"proxy"`
+	Redirect             *RedirectPolicy             `json:"redirect"`
+	TLS                  *TLSConfiguration           `json:"tls"`
+	Faults               []Fault                     `json:"faults"`
+	RateLimit            RateLimitConfiguration      `json:"rate_limit"`
+	CircuitBreaker       CircuitBreakerConfiguration `json:"circuit_breaker"`
 }
 
 // NewGozzle creates a new Gozzle object
 func NewGozzle() Gozzle {
-	return &gozzle{
-		client: &http.Client{},
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxyFromContext
+	g := &gozzle{
+		bodyLimitMode: BodyLimitTruncate,
+		client:        &http.Client{Transport: t},
+		decompression: true,
+		latencies:     newLatencyTracker(),
+		transport:     t,
 	}
+	return g.SetDialConfiguration(DialConfiguration{})
 }
 
 // NewGozzleFromConfiguration creates a new Gozzle object based on a configuration
 func NewGozzleFromConfiguration(c Configuration) Gozzle {
-	return NewGozzle().SetMaxSizeBody(c.MaxSizeBody)
+	g := NewGozzle().
+		SetMaxSizeBody(c.MaxSizeBody).
+		SetConcurrency(c.Concurrency).
+		SetTimeout(time.Duration(c.Timeout)).
+		SetBodyLimitMode(c.BodyLimitMode).
+		SetDecompression(!c.DisableDecompression).
+		SetCompression(c.Compression).
+		SetDialConfiguration(c.Dial).
+		SetEgressPolicy(c.Egress).
+		SetProxyConfiguration(c.Proxy).
+		SetRedirectPolicy(c.Redirect).
+		SetRateLimitConfiguration(c.RateLimit).
+		SetCircuitBreakerConfiguration(c.CircuitBreaker)
+	if len(c.Faults) > 0 {
+		g.AddMiddleware(NewFaultInjector(c.Faults...))
+	}
+	if c.TLS != nil {
+		g.SetTLSConfiguration(*c.TLS)
+	}
+	if c.Cookies != nil {
+		g.SetCookieJarIsolation(c.Cookies.Isolated)
+		var j http.CookieJar
+		var e error
+		if c.Cookies.File != "" && c.Cookies.Isolated {
+			e = fmt.Errorf("%w: file and isolation can't be combined", ErrInvalidCookieConfiguration)
+		} else if c.Cookies.File != "" {
+			j, e = NewFileCookieJar(c.Cookies.File)
+		} else if !c.Cookies.Isolated {
+			j, e = NewMemoryCookieJar()
+		}
+
+		// Requests fail with the error until a valid jar is set
+		if e != nil {
+			g.(*gozzle).cookieErr = e
+		} else if j != nil {
+			g.SetCookieJar(j)
+		}
+	}
+	return g
 }
 
 type gozzle struct {
-	maxSizeBody int
-	client      *http.Client
+	bodyLimitMode         string
+	decompression         bool
+	dialConfiguration     DialConfiguration
+	dialErr               error
+	egressPolicy          *EgressPolicy
+	maxSizeBody           int
+	middlewares           []Middleware
+	client                *http.Client
+	compression           *Compression
+	concurrency           int
+	cookieErr             error
+	cookieJarIsolation    bool
+	proxy                 *proxy
+	proxyConfiguration    *ProxyConfiguration
+	proxyErr              error
+	rateLimit             RateLimitConfiguration
+	redirectPolicy        *RedirectPolicy
+	rateLimiter           *rateLimiter
+	circuitBreaker        *circuitBreaker
+	circuitBreakerConfig  CircuitBreakerConfiguration
+	circuitBreakerHandler CircuitBreakerHandler
+	latencies             *latencyTracker
+	successPolicy         SuccessPolicy
+	tlsConfiguration      TLSConfiguration
+	tlsErr                error
+	transport             *http.Transport
 }
 
 func (g *gozzle) SetMaxSizeBody(maxSizeBody int) Gozzle {
@@ -63,81 +190,369 @@ func (g *gozzle) MaxSizeBody() int {
 	return g.maxSizeBody
 }
 
+// SetBodyLimitMode sets what happens when a response body is larger than the max size body
+// It's either BodyLimitTruncate (default), BodyLimitFail or BodyLimitDiscard
+func (g *gozzle) SetBodyLimitMode(m string) Gozzle {
+	if m == "" {
+		m = BodyLimitTruncate
+	}
+	g.bodyLimitMode = m
+	return g
+}
+
+// BodyLimitMode returns what happens when a response body is larger than the max size body
+func (g *gozzle) BodyLimitMode() string {
+	return g.bodyLimitMode
+}
+
+// AddMiddleware adds a middleware wrapping the round trip of every request
+// Middlewares are executed in the order they were added
+func (g *gozzle) AddMiddleware(m Middleware) Gozzle {
+	g.middlewares = append(g.middlewares, m)
+	return g
+}
+
+// Middlewares returns the middlewares
+func (g *gozzle) Middlewares() []Middleware {
+	return g.middlewares
+}
+
+// SetRateLimitConfiguration sets the global and per-host rate limits
+func (g *gozzle) SetRateLimitConfiguration(c RateLimitConfiguration) Gozzle {
+	g.rateLimit = c
+	g.rateLimiter = newRateLimiter(c)
+	return g
+}
+
+// RateLimitConfiguration returns the rate limiting configuration
+func (g *gozzle) RateLimitConfiguration() RateLimitConfiguration {
+	return g.rateLimit
+}
+
+// SetCircuitBreakerConfiguration sets the circuit breaker configuration
+// Setting a new configuration resets the state of all circuits
+func (g *gozzle) SetCircuitBreakerConfiguration(c CircuitBreakerConfiguration) Gozzle {
+	g.circuitBreakerConfig = c
+	g.circuitBreaker = newCircuitBreaker(c, g.circuitBreakerHandler)
+	return g
+}
+
+// CircuitBreakerConfiguration returns the circuit breaker configuration
+func (g *gozzle) CircuitBreakerConfiguration() CircuitBreakerConfiguration {
+	return g.circuitBreakerConfig
+}
+
+// SetCircuitBreakerHandler sets the handler executed each time a circuit changes state
+func (g *gozzle) SetCircuitBreakerHandler(h CircuitBreakerHandler) Gozzle {
+	g.circuitBreakerHandler = h
+	if g.circuitBreaker != nil {
+		g.circuitBreaker.handler = h
+	}
+	return g
+}
+
+// SetSuccessPolicy sets the policy deciding whether responses are successful
+// It can be overridden per request
+func (g *gozzle) SetSuccessPolicy(p SuccessPolicy) Gozzle {
+	g.successPolicy = p
+	return g
+}
+
+// SuccessPolicy returns the policy deciding whether responses are successful
+func (g *gozzle) SuccessPolicy() SuccessPolicy {
+	return g.successPolicy
+}
+
+// SetDecompression sets whether responses bodies are decompressed
+// When enabled, which is the default, requests advertise gzip, deflate, brotli and zstd support unless they set
+// their own Accept-Encoding header, and response bodies are decompressed based on their Content-Encoding header.
+// When disabled, response bodies are returned as received.
+func (g *gozzle) SetDecompression(d bool) Gozzle {
+	g.decompression = d
+	g.transport.DisableCompression = !d
+	return g
+}
+
+// Decompression returns whether response bodies are decompressed
+func (g *gozzle) Decompression() bool {
+	return g.decompression
+}
+
+// SetCompression sets the compression applied to request bodies
+// It can be overridden per request
+func (g *gozzle) SetCompression(c *Compression) Gozzle {
+	g.compression = c
+	return g
+}
+
+// Compression returns the compression applied to request bodies
+func (g *gozzle) Compression() *Compression {
+	return g.compression
+}
+
+// SetConcurrency sets the max number of requests sent at once by Exec
+// A value <= 0 means there's no limit
+func (g *gozzle) SetConcurrency(n int) Gozzle {
+	g.concurrency = n
+	return g
+}
+
+// Concurrency returns the max number of requests sent at once by Exec
+func (g *gozzle) Concurrency() int {
+	return g.concurrency
+}
+
+// SetTimeout sets the time limit of requests, including reading their response body
+// A value <= 0 means there's no timeout
+func (g *gozzle) SetTimeout(d time.Duration) Gozzle {
+	g.client.Timeout = d
+	return g
+}
+
+// Timeout returns the time limit of requests
+func (g *gozzle) Timeout() time.Duration {
+	return g.client.Timeout
+}
+
 // Exec executes a set of requests
 func (g gozzle) Exec(reqSet RequestSet) ResponseSet {
 	// Initialize
-	respSet := NewResponseSet()
 	reqNames := reqSet.Names()
+	respSet := newResponseSet(reqNames...)
+	g.client = g.requestSetClient(reqSet)
 
 	// Create wait group
 	wg := sync.WaitGroup{}
 	wg.Add(len(reqNames))
 
-	// Loop through requests
+	// Limit concurrency
+	var sem chan bool
+	if g.concurrency > 0 {
+		sem = make(chan bool, g.concurrency)
+	}
+
+	// Fail every request if some have been ignored because of their duplicate name
+	if e := reqSet.Validate(); errors.Is(e, ErrDuplicateName) {
+		for _, name := range reqNames {
+			respSet.AddResponse(reqSet.GetRequest(name), newResponseError(e, Timing{}))
+		}
+		return respSet
+	}
+
+	// Plan execution
+	x := newExecution(reqSet)
+
+	// Loop through requests in order
+	// Requests that don't wait for variables take their concurrency slot in order whereas the others take it once
+	// their variables are available so that they don't block the requests they're waiting for
 	for _, name := range reqNames {
-		go func(req Request) {
+		// Acquire slot
+		acquired := sem != nil && !x.waits(name)
+		if acquired {
+			sem <- true
+		}
+
+		go func(req Request, acquired bool) {
 			defer wg.Done()
-			if resp := g.execRequest(req); resp != nil {
-				respSet.AddResponse(req, resp)
+			defer x.finish(req.Name())
+
+			// Release slot
+			defer func() {
+				if acquired {
+					<-sem
+				}
+			}()
+
+			// Wait for variables
+			req, e := x.prepare(req)
+			if e != nil {
+				respSet.AddResponse(req, newResponseError(e, Timing{}))
+				return
 			}
-		}(reqSet.GetRequest(name))
+
+			// Acquire slot
+			if sem != nil && !acquired {
+				sem <- true
+				acquired = true
+			}
+
+			// Execute request
+			respSet.AddResponse(req, g.execRequest(req, x.vars()))
+		}(reqSet.GetRequest(name), acquired)
 	}
 
 	// Wait
 	wg.Wait()
 
 	// Return
+	respSet.setVariables(x.all())
 	return respSet
 }
 
-func (g gozzle) execRequest(req Request) Response {
-	// Before handler
-	if req.BeforeHandler() != nil {
-		cont := req.BeforeHandler()(req)
-		if !cont {
-			return nil
+func (g gozzle) execRequest(req Request, vs *variables) Response {
+	// Before handlers
+	if resp := runBeforeHandlers(req); resp != nil {
+		return resp
+	}
+
+	// Send request
+	resp := g.sendRequest(req)
+
+	// Extract variables
+	if vs != nil && resp.originalResponse != nil {
+		resp.extract(req, vs)
+	}
+
+	// Check expectations
+	resp.expectations = checkExpectations(req, resp)
+
+	// After handler
+	if resp.originalResponse != nil && req.AfterHandler() != nil {
+		req.AfterHandler()(req, resp)
+	}
+
+	// Return
+	return resp
+}
+
+func (g gozzle) sendRequest(req Request) *response {
+	// Check configuration
+	for _, e := range []error{g.cookieErr, g.dialErr, g.tlsErr} {
+		if e != nil {
+			return newResponseError(e, Timing{})
 		}
 	}
 
+	// Create http request
+	httpReq, e := g.newHTTPRequest(req)
+	if e != nil {
+		return newResponseError(e, Timing{})
+	}
+	defer closeRequestBody(httpReq)
+
+	// TODO Add context
+
+	// Check circuit breaker
+	// It's checked first so that requests it rejects don't take rate limiter tokens
+	var t Timing
+	k := g.circuitBreaker.key(req, httpReq)
+	if e = g.circuitBreaker.allow(k); e != nil {
+		return newResponseError(e, t)
+	}
+
+	// Wait for the rate limiter
+	if t.QueueWait, e = g.rateLimiter.wait(httpReq); e != nil {
+		g.circuitBreaker.release(k)
+		return newResponseError(e, t)
+	}
+
+	// Send request
+	t.Start = time.Now()
+	httpResp, e := g.hedge(req, httpReq, g.roundTrip())
+	t.Duration = time.Since(t.Start)
+	g.circuitBreaker.record(k, e != nil || httpResp.StatusCode >= 500)
+	if e != nil {
+		return newResponseError(e, t)
+	}
+
+	// Adapt rate limits
+	g.rateLimiter.feedback(httpReq, httpResp)
+
+	// Create response
+	resp := newResponse(httpResp, g.responseOptions(req))
+	resp.reconnect = g.reconnectFunc(req)
+	resp.redirects = redirects(httpResp)
+	resp.timing = t
+	return resp
+}
+
+func (g gozzle) roundTrip() RoundTrip {
+	// Initialize
+	var rt RoundTrip = func(req Request, httpReq *http.Request) (*http.Response, error) {
+		c := *g.client
+		c.CheckRedirect = g.requestRedirectPolicy(req).checkRedirect(req)
+		return c.Do(httpReq)
+	}
+
+	// Wrap middlewares so that the first added is the outermost
+	for i := len(g.middlewares) - 1; i >= 0; i-- {
+		rt = g.middlewares[i](rt)
+	}
+	return rt
+}
+
+// newHTTPRequest creates the http request sent for the request, going through its proxy and negotiating its encoding
+// Every http request sent for a request, including hedged copies and reconnections, must be created by it.
+func (g gozzle) newHTTPRequest(req Request) (*http.Request, error) {
+	// Create http request
+	httpReq, e := newBaseHTTPRequest(req, g.requestCompression(req))
+	if e != nil {
+		return nil, e
+	}
+
+	// Select proxy
+	if httpReq, e = g.withProxy(req, httpReq); e != nil {
+		closeRequestBody(httpReq)
+		return nil, e
+	}
+
+	// Negotiate encoding
+	if g.decompression {
+		negotiateEncoding(httpReq)
+	}
+	return httpReq, nil
+}
+
+func newBaseHTTPRequest(req Request, c *Compression) (*http.Request, error) {
 	// Get body
 	b, e := body(req)
-	defer b.Close()
 	if e != nil {
-		return NewResponseError(e)
+		b.Close()
+		return nil, e
+	}
+
+	// Compress body
+	var encoding string
+	if c != nil && (req.Body() != nil || req.BodyReader() != nil) && req.GetHeader("Content-Encoding") == "" {
+		if b, encoding, e = compressBody(b, c); e != nil {
+			b.Close()
+			return nil, e
+		}
+	}
+
+	// Get URL
+	u := req.FullPath()
+	socket, su, e := unixSocketURL(u)
+	if e != nil {
+		b.Close()
+		return nil, e
+	} else if socket != "" {
+		u = su
 	}
 
 	// Create http request
 	httpReq, e := http.NewRequest(
 		req.Method(),
-		req.FullPath(),
+		u,
 		b,
 	)
 	if e != nil {
-		return NewResponseError(e)
+		b.Close()
+		return nil, e
 	}
 	httpReq.Close = true
 
-	// Add headers
-	headers(req, httpReq)
-
-	// TODO Add timeout and context
-
-	// Send request
-	httpResp, e := g.client.Do(httpReq)
-	if e != nil {
-		return NewResponseError(e)
+	// Target Unix domain socket
+	if socket != "" {
+		httpReq = httpReq.WithContext(context.WithValue(httpReq.Context(), unixSocketContextKey{}, socket))
 	}
 
-	// Create response
-	resp := NewResponse(httpResp, g.maxSizeBody)
-
-	// After handler
-	if req.AfterHandler() != nil {
-		req.AfterHandler()(req, resp)
+	// Add headers
+	headers(req, httpReq)
+	if encoding != "" {
+		httpReq.Header.Set("Content-Encoding", encoding)
 	}
-
-	// Return
-	return resp
+	return httpReq, nil
 }
 
 func body(r Request) (io.ReadCloser, error) {
@@ -152,21 +567,30 @@ func body(r Request) (io.ReadCloser, error) {
 			bodyReader = ioutil.NopCloser(r.BodyReader())
 		}
 		return bodyReader, e
+	} else if b, ok := r.Body().(RawBody); ok {
+		// Raw body
+		body = b
 	} else if r.Body() != nil {
-		// Get body reader
-		if r.GetHeader("Content-Type") == "application/xml" {
-			// XML marshall
-			body, e = xml.Marshal(r.Body())
-		} else {
-			// JSON marshall
-			body, e = json.Marshal(r.Body())
-		}
+		body, e = encodeBody(r)
 	}
 
 	// Return
 	return ioutil.NopCloser(bytes.NewBuffer(body)), e
 }
 
+func encodeBody(r Request) ([]byte, error) {
+	if isXMLBody(r) {
+		// XML marshall
+		return xml.Marshal(r.Body())
+	}
+	// JSON marshall
+	return json.Marshal(r.Body())
+}
+
+func isXMLBody(r Request) bool {
+	return r.GetHeader("Content-Type") == "application/xml"
+}
+
 func headers(r Request, hr *http.Request) {
 	// Loop through headers
 	for k, v := range r.Headers() {
@@ -9,7 +9,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"bytes"
 
@@ -101,7 +104,9 @@ func TestExecRequestBeforeHandler(t *testing.T) {
 	respSet := g.Exec(reqSet)
 
 	// Assert
-	assert.Len(t, respSet.Names(), 0)
+	assert.Equal(t, []string{"test"}, respSet.Names())
+	assert.Equal(t, ResponseStateSkipped, respSet.GetResponse("test").State())
+	assert.Equal(t, "Before handler returned false", respSet.GetResponse("test").SkipReason())
 }
 
 func TestExecRequestError(t *testing.T) {
@@ -133,11 +138,78 @@ func TestExecRequestError(t *testing.T) {
 	assert.Len(t, respSet.Names(), 2)
 	assert.Equal(t, c, respSet.GetResponse("test1").StatusCode())
 	assert.Len(t, respSet.GetResponse("test1").Errors(), 1)
-	assert.EqualError(t, respSet.GetResponse("test1").Errors()[0], ErrInvalidStatusCode.Error())
+	assert.EqualError(t, respSet.GetResponse("test1").Errors()[0], "Invalid status code 500 Internal Server Error")
 	assert.Len(t, respSet.GetResponse("test2").Errors(), 1)
 	assert.EqualError(t, respSet.GetResponse("test2").Errors()[0], "Get test: unsupported protocol scheme \"\"")
 }
 
+func TestExecConcurrency(t *testing.T) {
+	// Initialize
+	var current, max int32
+
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := atomic.AddInt32(&current, 1)
+		for m := atomic.LoadInt32(&max); c > m && !atomic.CompareAndSwapInt32(&max, m, c); m = atomic.LoadInt32(&max) {
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+	}))
+	defer server.Close()
+
+	// Create request set
+	reqSet := NewRequestSet()
+	for i := 0; i < 6; i++ {
+		reqSet.AddRequest(NewRequest(fmt.Sprintf("test%d", i), MethodGet, server.URL))
+	}
+
+	// Execute requests
+	respSet := NewGozzleFromConfiguration(Configuration{Concurrency: 2}).Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.Len(t, respSet.Names(), 6)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestExecOrder(t *testing.T) {
+	// Initialize
+	var m sync.Mutex
+	var paths []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		paths = append(paths, r.URL.Path)
+		m.Unlock()
+	}))
+	defer s.Close()
+	reqSet := NewOrderedRequestSet()
+	for _, n := range []string{"c", "a", "d", "b"} {
+		reqSet.AddRequest(NewRequest(n, MethodGet, s.URL+"/"+n))
+	}
+	reqSet.AddRequestWithPriority(NewRequest("e", MethodGet, s.URL+"/e"), 1)
+
+	// Execute
+	respSet := NewGozzle().SetConcurrency(1).Exec(reqSet)
+
+	// Assert
+	assert.Equal(t, []string{"/e", "/c", "/a", "/d", "/b"}, paths)
+	assert.Equal(t, []string{"e", "c", "a", "d", "b"}, respSet.Names())
+}
+
+func TestExecTimeout(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	// Execute requests
+	respSet := NewGozzle().SetTimeout(10 * time.Millisecond).Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, server.URL)))
+
+	// Assert
+	assert.Len(t, respSet.GetResponse("test").Errors(), 1)
+}
+
 func TestBody(t *testing.T) {
 	// Initialize
 	r := request{
@@ -161,6 +233,42 @@ func TestBody(t *testing.T) {
 	assert.Equal(t, "{\"test\":\"message\"}", string(c))
 }
 
+func TestBodyRaw(t *testing.T) {
+	// Initialize
+	r := request{
+		body: RawBody("test"),
+	}
+
+	// Get body reader
+	b, e := body(&r)
+	assert.NoError(t, e)
+
+	// Read body
+	c, e := ioutil.ReadAll(b)
+	assert.NoError(t, e)
+
+	// Assert
+	assert.Equal(t, "test", string(c))
+}
+
+func TestBodyBytes(t *testing.T) {
+	// Initialize
+	r := request{
+		body: []byte("test"),
+	}
+
+	// Get body reader
+	b, e := body(&r)
+	assert.NoError(t, e)
+
+	// Read body
+	c, e := ioutil.ReadAll(b)
+	assert.NoError(t, e)
+
+	// Assert
+	assert.Equal(t, "\"dGVzdA==\"", string(c))
+}
+
 func TestBodyEmpty(t *testing.T) {
 	r := request{
 		body: interface{}(nil),
@@ -0,0 +1,228 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	hedgingMinSamples = 10
+	hedgingMaxSamples = 100
+)
+
+// Hedging represents a request hedging configuration
+//
+// If no response has been received after Delay, or as soon as an attempt fails, another copy of the request is sent
+// and the first response received wins. Losing copies are cancelled and their bodies closed.
+// When Percentile is in ]0, 100[ and enough latencies of original requests have been observed for the request name,
+// the delay is the observed latency at this percentile instead.
+// MaxHedges is the max number of copies sent in addition to the original request.
+// Hosts, when set, are used in turn as hosts of the copies. They are either hosts ("replica:8080") or base URLs
+// ("https://replica:8443").
+// Requests whose body is set with SetBodyReader can't be replayed and are therefore never hedged.
+type Hedging struct {
+	Delay      time.Duration
+	Percentile float64
+	MaxHedges  int
+	Hosts      []string
+}
+
+type hedgeResult struct {
+	err      error
+	httpResp *http.Response
+	index    int
+}
+
+func (g gozzle) hedge(req Request, httpReq *http.Request, rt RoundTrip) (*http.Response, error) {
+	// No hedging
+	h := req.Hedging()
+	if h == nil || h.MaxHedges <= 0 || req.BodyReader() != nil {
+		return rt(req, httpReq)
+	}
+
+	// Initialize
+	results := make(chan hedgeResult, h.MaxHedges+1)
+	var cancels []context.CancelFunc
+	send := func(r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			s := time.Now()
+			httpResp, e := rt(req, r.WithContext(ctx))
+
+			// Only the latency of the original request is tracked since winning copies would lower the delay. When it
+			// loses, the time until it's cancelled is a lower bound of its latency.
+			if i == 0 && (e == nil || ctx.Err() != nil) {
+				g.latencies.add(req.Name(), time.Since(s))
+			}
+			results <- hedgeResult{err: e, httpResp: httpResp, index: i}
+		}()
+	}
+
+	// Send original request
+	send(httpReq)
+	sent, pending := 0, 1
+	sendCopy := func() {
+		for sent < h.MaxHedges {
+			sent++
+			if r, e := g.hedgedHTTPRequest(req, httpReq, h, sent); e == nil {
+				send(r)
+				pending++
+				return
+			}
+		}
+	}
+
+	// Create timer
+	d := g.hedgeDelay(req)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	// Loop
+	var last hedgeResult
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			// Send copy
+			sendCopy()
+			if sent < h.MaxHedges {
+				timer.Reset(d)
+			}
+		case last = <-results:
+			pending--
+			if last.err != nil {
+				cancels[last.index]()
+
+				// Send the next copy right away
+				if sent < h.MaxHedges {
+					if !timer.Stop() {
+						select {
+						case <-timer.C:
+						default:
+						}
+					}
+					sendCopy()
+					if sent < h.MaxHedges {
+						timer.Reset(d)
+					}
+				}
+				continue
+			}
+
+			// Cancel losing copies
+			for i, c := range cancels {
+				if i != last.index {
+					c()
+				}
+			}
+			go drainHedgeResults(results, pending)
+
+			// The winner is cancelled once its body is closed
+			last.httpResp.Body = cancelReadCloser{ReadCloser: last.httpResp.Body, cancel: cancels[last.index]}
+			return last.httpResp, nil
+		}
+	}
+	return last.httpResp, last.err
+}
+
+func drainHedgeResults(results chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if r := <-results; r.err == nil {
+			r.httpResp.Body.Close()
+		}
+	}
+}
+
+func (g gozzle) hedgedHTTPRequest(req Request, original *http.Request, h *Hedging, i int) (*http.Request, error) {
+	// Create http request
+	r, e := g.newHTTPRequest(req)
+	if e != nil {
+		return nil, e
+	}
+	r.Header = original.Header.Clone()
+
+	// Switch host
+	if len(h.Hosts) > 0 {
+		host := h.Hosts[(i-1)%len(h.Hosts)]
+		if strings.Contains(host, "://") {
+			var u *url.URL
+			if u, e = url.Parse(host); e != nil {
+				closeRequestBody(r)
+				return nil, e
+			}
+			r.URL.Scheme = u.Scheme
+			host = u.Host
+		}
+		r.URL.Host = host
+		r.Host = host
+	}
+	return r, nil
+}
+
+func (g gozzle) hedgeDelay(req Request) time.Duration {
+	h := req.Hedging()
+	if h.Percentile > 0 && h.Percentile < 100 {
+		if d, ok := g.latencies.percentile(req.Name(), h.Percentile); ok {
+			return d
+		}
+	}
+	return h.Delay
+}
+
+type latencyTracker struct {
+	latencies map[string][]time.Duration
+	mutex     sync.Mutex
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{latencies: make(map[string][]time.Duration)}
+}
+
+func (t *latencyTracker) add(name string, d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ls := append(t.latencies[name], d)
+	if len(ls) > hedgingMaxSamples {
+		ls = ls[len(ls)-hedgingMaxSamples:]
+	}
+	t.latencies[name] = ls
+}
+
+func (t *latencyTracker) percentile(name string, p float64) (time.Duration, bool) {
+	// Copy latencies
+	t.mutex.Lock()
+	ls := append([]time.Duration{}, t.latencies[name]...)
+	t.mutex.Unlock()
+
+	// Not enough samples
+	if len(ls) < hedgingMinSamples {
+		return 0, false
+	}
+
+	// Sort
+	sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+	return ls[int(float64(len(ls)-1)*p/100)], true
+}
+
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements the io.Closer interface
+func (r cancelReadCloser) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,150 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecHedging(t *testing.T) {
+	// Create servers
+	cancelled := make(chan bool, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			cancelled <- true
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	// Create request set
+	reqSet := NewRequestSet().AddRequest(NewRequest("test", MethodGet, slow.URL).SetHedging(&Hedging{
+		Delay:     20 * time.Millisecond,
+		MaxHedges: 1,
+		Hosts:     []string{fast.URL},
+	}))
+
+	// Execute requests
+	s := time.Now()
+	g := NewGozzle()
+	respSet := g.Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.True(t, time.Since(s) < 500*time.Millisecond)
+	resp := respSet.GetResponse("test")
+	assert.Len(t, resp.Errors(), 0)
+	b, e := ioutil.ReadAll(resp.BodyReader())
+	assert.NoError(t, e)
+	assert.Equal(t, "fast", string(b))
+	select {
+	case <-cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("losing request was not cancelled")
+	}
+
+	// Only the latency of the original request is tracked
+	l := g.(*gozzle).latencies
+	assert.Eventually(t, func() bool {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return len(l.latencies["test"]) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, l.latencies["test"][0] >= 20*time.Millisecond)
+}
+
+func TestExecHedgingEarlyFailure(t *testing.T) {
+	// Create servers
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	failing.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	// Create request set
+	reqSet := NewRequestSet().AddRequest(NewRequest("test", MethodGet, failing.URL).SetHedging(&Hedging{
+		Delay:     time.Minute,
+		MaxHedges: 2,
+		Hosts:     []string{failing.URL, fast.URL},
+	}))
+
+	// Execute requests
+	s := time.Now()
+	respSet := NewGozzle().Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.True(t, time.Since(s) < 500*time.Millisecond)
+	b, e := respSet.GetResponse("test").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "fast", string(b))
+}
+
+func TestExecHedgingOriginalWins(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test"))
+	}))
+	defer server.Close()
+
+	// Create request set
+	reqSet := NewRequestSet().AddRequest(NewRequest("test", MethodGet, server.URL).SetHedging(&Hedging{
+		Delay:     time.Second,
+		MaxHedges: 2,
+	}))
+
+	// Execute requests
+	respSet := NewGozzle().Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	b, e := respSet.GetResponse("test").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "test", string(b))
+}
+
+func TestLatencyTracker(t *testing.T) {
+	// Initialize
+	l := newLatencyTracker()
+
+	// Not enough samples
+	l.add("test", time.Millisecond)
+	_, ok := l.percentile("test", 50)
+	assert.False(t, ok)
+
+	// Percentile
+	for i := 2; i <= hedgingMaxSamples+1; i++ {
+		l.add("test", time.Duration(i)*time.Millisecond)
+	}
+	d, ok := l.percentile("test", 90)
+	assert.True(t, ok)
+	assert.Equal(t, 91*time.Millisecond, d)
+}
+
+func TestHedgeDelay(t *testing.T) {
+	// Initialize
+	g := NewGozzle().(*gozzle)
+	r := NewRequest("test", MethodGet, "/").SetHedging(&Hedging{Delay: time.Second, Percentile: 50})
+
+	// Assert
+	assert.Equal(t, time.Second, g.hedgeDelay(r))
+	for i := 0; i < hedgingMinSamples; i++ {
+		g.latencies.add("test", time.Millisecond)
+	}
+	assert.Equal(t, time.Millisecond, g.hedgeDelay(r))
+}
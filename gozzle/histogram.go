@@ -0,0 +1,163 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	histogramSubBucketBits  = 7
+	histogramSubBucketCount = 1 << histogramSubBucketBits
+	histogramSubBucketHalf  = histogramSubBucketCount / 2
+)
+
+// Histogram represents an HDR-style latency histogram
+// Durations are recorded in log-linear buckets so that values are reported with a relative precision of about 1%
+// whatever their magnitude, using a constant amount of memory.
+type Histogram interface {
+	Count() int
+	Max() time.Duration
+	Mean() time.Duration
+	Min() time.Duration
+	Percentile(p float64) time.Duration
+	Record(d time.Duration) Histogram
+}
+
+// NewHistogram creates a new histogram
+func NewHistogram() Histogram {
+	return &histogram{}
+}
+
+type histogram struct {
+	count  int
+	counts []int
+	max    time.Duration
+	min    time.Duration
+	mutex  sync.Mutex
+	sum    time.Duration
+}
+
+// histogramIndex returns the index of the bucket containing v
+// Values below histogramSubBucketCount have their own bucket, then each power of 2 is split in histogramSubBucketHalf
+// buckets.
+func histogramIndex(v uint64) int {
+	if v < histogramSubBucketCount {
+		return int(v)
+	}
+	s := bits.Len64(v) - histogramSubBucketBits
+	return s*histogramSubBucketHalf + int(v>>uint(s))
+}
+
+// histogramValue returns the value in the middle of the bucket at index i
+func histogramValue(i int) uint64 {
+	if i < histogramSubBucketCount {
+		return uint64(i)
+	}
+	s := uint(i/histogramSubBucketHalf - 1)
+	sub := uint64(i - int(s)*histogramSubBucketHalf)
+	return sub<<s + (1<<s)/2
+}
+
+// Record implements the Histogram interface
+func (h *histogram) Record(d time.Duration) Histogram {
+	// Lock
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// Update buckets
+	if d < 0 {
+		d = 0
+	}
+	i := histogramIndex(uint64(d))
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int, i-len(h.counts)+1)...)
+	}
+	h.counts[i]++
+
+	// Update stats
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+	return h
+}
+
+// Count implements the Histogram interface
+func (h *histogram) Count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+// Max implements the Histogram interface
+func (h *histogram) Max() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.max
+}
+
+// Mean implements the Histogram interface
+func (h *histogram) Mean() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Min implements the Histogram interface
+func (h *histogram) Min() time.Duration {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.min
+}
+
+// Percentile implements the Histogram interface
+// p is between 0 and 100. The returned value is bounded by the min and max recorded values.
+func (h *histogram) Percentile(p float64) time.Duration {
+	// Lock
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// No values
+	if h.count == 0 {
+		return 0
+	} else if p <= 0 {
+		return h.min
+	} else if p >= 100 {
+		return h.max
+	}
+
+	// Get rank
+	rank := int(math.Ceil(p / 100 * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	// Loop through buckets
+	var n int
+	for i, c := range h.counts {
+		if n += c; n >= rank {
+			v := time.Duration(histogramValue(i))
+			if v < h.min {
+				v = h.min
+			} else if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,51 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramIndex(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 129, 255, 256, 1000, 123456789, 1 << 40} {
+		m := histogramValue(histogramIndex(v))
+		assert.InDelta(t, float64(v), float64(m), float64(v)/100+1, v)
+	}
+	assert.Equal(t, histogramIndex(127)+1, histogramIndex(128))
+	assert.Equal(t, histogramIndex(254), histogramIndex(255))
+	assert.Equal(t, histogramIndex(255)+1, histogramIndex(256))
+}
+
+func TestHistogram(t *testing.T) {
+	// Empty
+	h := NewHistogram()
+	assert.Equal(t, 0, h.Count())
+	assert.Equal(t, time.Duration(0), h.Percentile(50))
+	assert.Equal(t, time.Duration(0), h.Mean())
+
+	// Record
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	// Assert
+	assert.Equal(t, 10000, h.Count())
+	assert.Equal(t, time.Microsecond, h.Min())
+	assert.Equal(t, 10*time.Millisecond, h.Max())
+	assert.Equal(t, 5000500*time.Nanosecond, h.Mean())
+	for p, e := range map[float64]time.Duration{
+		50:   5 * time.Millisecond,
+		90:   9 * time.Millisecond,
+		99:   9900 * time.Microsecond,
+		99.9: 9990 * time.Microsecond,
+	} {
+		assert.InDelta(t, float64(e), float64(h.Percentile(p)), float64(e)/100, p)
+	}
+	assert.Equal(t, time.Microsecond, h.Percentile(0))
+	assert.Equal(t, 10*time.Millisecond, h.Percentile(100))
+}
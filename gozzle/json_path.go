@@ -0,0 +1,123 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonPath returns the value located at path in decoded JSON data
+// Paths look like "$.data.items[0].id". The leading "$" or "$." is optional and an empty path returns the data itself.
+func jsonPath(data interface{}, path string) (interface{}, bool) {
+	// Trim root
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	// Loop through segments
+	v := data
+	for path != "" {
+		// Get next segment
+		var s string
+		if path[0] == '[' {
+			i := strings.Index(path, "]")
+			if i < 0 {
+				return nil, false
+			}
+			s, path = path[:i+1], path[i+1:]
+		} else if i := strings.IndexAny(path, ".["); i > -1 {
+			s, path = path[:i], path[i:]
+		} else {
+			s, path = path, ""
+		}
+		path = strings.TrimPrefix(path, ".")
+
+		// Index
+		if strings.HasPrefix(s, "[") {
+			a, ok := v.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			i, e := strconv.Atoi(strings.Trim(s, "[]"))
+			if e != nil {
+				return nil, false
+			}
+			if i < 0 {
+				i += len(a)
+			}
+			if i < 0 || i >= len(a) {
+				return nil, false
+			}
+			v = a[i]
+			continue
+		}
+
+		// Key
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[s]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// decodeJSON decodes JSON data, numbers being decoded as json.Number so that they keep their exact value
+func decodeJSON(b []byte) (v interface{}, e error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if e = d.Decode(&v); e != nil {
+		return nil, e
+	}
+	if _, e = d.Token(); e != io.EOF {
+		return nil, errors.New("invalid data after top-level value")
+	}
+	return v, nil
+}
+
+// equalJSON checks whether decoded JSON data are equal, numbers being compared by value
+func equalJSON(a, b interface{}) bool {
+	switch at := a.(type) {
+	case json.Number:
+		bt, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := new(big.Rat).SetString(string(at))
+		br, bok := new(big.Rat).SetString(string(bt))
+		return aok && bok && ar.Cmp(br) == 0
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !equalJSON(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, v := range at {
+			if w, ok := bt[k]; !ok || !equalJSON(v, w) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPath(t *testing.T) {
+	// Initialize
+	var d interface{}
+	assert.NoError(t, json.Unmarshal([]byte("{\"a\":{\"b\":[{\"c\":1},{\"c\":2}]},\"d\":[[\"e\"]]}"), &d))
+
+	// Assert
+	for p, e := range map[string]interface{}{
+		"a.b[0].c":   1.0,
+		"$.a.b[1].c": 2.0,
+		"a.b[-1].c":  2.0,
+		"$.d[0][0]":  "e",
+		"d[0]":       []interface{}{"e"},
+	} {
+		v, ok := jsonPath(d, p)
+		assert.True(t, ok, p)
+		assert.Equal(t, e, v, p)
+	}
+	v, ok := jsonPath(d, "$")
+	assert.True(t, ok)
+	assert.Equal(t, d, v)
+	for _, p := range []string{"x", "a.b[2]", "a.b.c", "a[0]", "d[x]", "a.b[0"} {
+		_, ok = jsonPath(d, p)
+		assert.False(t, ok, p)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	// Numbers
+	d, e := decodeJSON([]byte(`{"a":9007199254740993,"b":[1.50]}`))
+	assert.NoError(t, e)
+	v, ok := jsonPath(d, "a")
+	assert.True(t, ok)
+	assert.Equal(t, json.Number("9007199254740993"), v)
+
+	// Equality
+	ev, e := decodeJSON([]byte(`{"a":9007199254740993,"b":[1.5]}`))
+	assert.NoError(t, e)
+	assert.True(t, equalJSON(ev, d))
+	ev, e = decodeJSON([]byte(`{"a":9007199254740992,"b":[1.5]}`))
+	assert.NoError(t, e)
+	assert.False(t, equalJSON(ev, d))
+	assert.False(t, equalJSON(json.Number("1"), "1"))
+
+	// Invalid
+	_, e = decodeJSON([]byte(`{"a":1} x`))
+	assert.Error(t, e)
+}
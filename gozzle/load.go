@@ -0,0 +1,250 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	defaultLoadDuration = 10 * time.Second
+)
+
+// Variables
+var (
+	ErrInvalidRate = errors.New("Invalid rate")
+)
+
+// LoadGenerator represents a generator executing a request set repeatedly in order to load-test endpoints
+type LoadGenerator interface {
+	// Run executes the request set until the duration is reached or Stop is called and returns the report. It can only
+	// be called once and fails with ErrInvalidRate if the rate is NaN, infinite or too high to be enforced.
+	Run() (*LoadReport, error)
+	// SetConcurrency sets the number of workers executing the request set at once. Default is 1.
+	SetConcurrency(n int) LoadGenerator
+	// SetDuration sets how long the request set is executed. Default is 10s.
+	SetDuration(d time.Duration) LoadGenerator
+	// SetRate sets the number of request set executions started per second. A value <= 0 means workers execute the
+	// request set as fast as they can. The rate can't exceed what the workers are able to sustain.
+	SetRate(r float64) LoadGenerator
+	// Stop stops a running load test
+	Stop()
+}
+
+// LoadReport represents the results of a load test
+type LoadReport struct {
+	Duration   time.Duration
+	Iterations int
+	Requests   map[string]*LoadStats
+}
+
+// LoadStats represents the results of a load test for a request name
+// Errors are counted by message. Latencies measure the time until response headers are received and only include
+// requests that have been sent. Skipped requests are only counted in Skipped.
+type LoadStats struct {
+	Count      int
+	Errors     map[string]int
+	Latency    Histogram
+	Skipped    int
+	Statuses   map[int]int
+	Throughput float64
+}
+
+// NewLoadGenerator creates a new load generator executing the request set through gozzle
+// The request set is cloned before each execution so that handlers can't alter the following executions.
+func NewLoadGenerator(g Gozzle, reqSet RequestSet) LoadGenerator {
+	return &loadGenerator{
+		concurrency: 1,
+		duration:    defaultLoadDuration,
+		gozzle:      g,
+		reqSet:      reqSet,
+		stop:        make(chan struct{}),
+	}
+}
+
+type loadGenerator struct {
+	concurrency int
+	duration    time.Duration
+	gozzle      Gozzle
+	mutex       sync.Mutex
+	once        sync.Once
+	rate        float64
+	report      *LoadReport
+	reqSet      RequestSet
+	stop        chan struct{}
+}
+
+// SetConcurrency implements the LoadGenerator interface
+func (l *loadGenerator) SetConcurrency(n int) LoadGenerator {
+	if n < 1 {
+		n = 1
+	}
+	l.concurrency = n
+	return l
+}
+
+// SetDuration implements the LoadGenerator interface
+func (l *loadGenerator) SetDuration(d time.Duration) LoadGenerator {
+	l.duration = d
+	return l
+}
+
+// SetRate implements the LoadGenerator interface
+func (l *loadGenerator) SetRate(r float64) LoadGenerator {
+	l.rate = r
+	return l
+}
+
+// Stop implements the LoadGenerator interface
+func (l *loadGenerator) Stop() {
+	l.once.Do(func() { close(l.stop) })
+}
+
+// Run implements the LoadGenerator interface
+func (l *loadGenerator) Run() (*LoadReport, error) {
+	// Get rate interval
+	var interval time.Duration
+	if math.IsNaN(l.rate) || math.IsInf(l.rate, 0) {
+		return nil, fmt.Errorf("%w %v", ErrInvalidRate, l.rate)
+	} else if l.rate > 0 {
+		if interval = time.Duration(float64(time.Second) / l.rate); interval <= 0 {
+			return nil, fmt.Errorf("%w %v", ErrInvalidRate, l.rate)
+		}
+	}
+
+	// Initialize
+	l.report = &LoadReport{Requests: make(map[string]*LoadStats)}
+	for _, name := range l.reqSet.Names() {
+		l.report.Requests[name] = newLoadStats()
+	}
+
+	// Stop once the duration is reached
+	t := time.AfterFunc(l.duration, l.Stop)
+	defer t.Stop()
+
+	// Create rate ticker
+	var tokens <-chan time.Time
+	if interval > 0 {
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+		tokens = tk.C
+	}
+
+	// Start workers
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < l.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				// Wait for a token
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-l.stop:
+						return
+					}
+				}
+
+				// Check whether the load test is over
+				select {
+				case <-l.stop:
+					return
+				default:
+				}
+
+				// Execute request set
+				l.iterate()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Compute throughputs
+	l.report.Duration = time.Since(start)
+	for _, s := range l.report.Requests {
+		if l.report.Duration > 0 {
+			s.Throughput = float64(s.Count) / l.report.Duration.Seconds()
+		}
+	}
+	return l.report, nil
+}
+
+func newLoadStats() *LoadStats {
+	return &LoadStats{
+		Errors:   make(map[string]int),
+		Latency:  NewHistogram(),
+		Statuses: make(map[int]int),
+	}
+}
+
+func (l *loadGenerator) iterate() {
+	// Execute request set
+	respSet := l.gozzle.Exec(l.reqSet.Clone())
+	defer respSet.Close()
+
+	// Loop through responses
+	for _, name := range respSet.Names() {
+		// Drain body so that the connection can be reused
+		resp := respSet.GetResponse(name)
+		var e error
+		if len(resp.Errors()) == 0 {
+			if b := resp.BodyReader(); b != nil {
+				_, e = io.Copy(ioutil.Discard, b)
+			}
+		}
+
+		// Record
+		l.record(name, resp, e)
+	}
+
+	// Update iterations
+	l.mutex.Lock()
+	l.report.Iterations++
+	l.mutex.Unlock()
+}
+
+func (l *loadGenerator) record(name string, resp Response, e error) {
+	// Lock
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Get stats
+	s, ok := l.report.Requests[name]
+	if !ok {
+		s = newLoadStats()
+		l.report.Requests[name] = s
+	}
+
+	// Skipped
+	if resp.State() == ResponseStateSkipped {
+		s.Skipped++
+		return
+	}
+
+	// Update stats
+	// Only requests that have been sent have a latency
+	s.Count++
+	if !resp.Timing().Start.IsZero() {
+		s.Latency.Record(resp.Timing().Duration)
+	}
+	if c := resp.StatusCode(); c > 0 {
+		s.Statuses[c]++
+	}
+	for _, err := range resp.Errors() {
+		s.Errors[err.Error()]++
+	}
+	if e != nil {
+		s.Errors[e.Error()]++
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGenerator(t *testing.T) {
+	// Initialize
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("ok", MethodGet, s.URL+"/ok"))
+	reqSet.AddRequest(NewRequest("error", MethodGet, s.URL+"/error"))
+	reqSet.AddRequest(NewRequest("skipped", MethodGet, s.URL+"/ok").SetBeforeHandler(func(r Request) bool { return false }))
+
+	// Run
+	r, e := NewLoadGenerator(NewGozzle(), reqSet).SetConcurrency(2).SetDuration(100 * time.Millisecond).Run()
+	assert.NoError(t, e)
+
+	// Assert
+	assert.True(t, r.Duration >= 100*time.Millisecond)
+	assert.True(t, r.Iterations > 0)
+	assert.Equal(t, int(atomic.LoadInt32(&count)), r.Requests["ok"].Count+r.Requests["error"].Count)
+	assert.Equal(t, r.Iterations, r.Requests["ok"].Count)
+	assert.Equal(t, map[int]int{http.StatusOK: r.Iterations}, r.Requests["ok"].Statuses)
+	assert.Empty(t, r.Requests["ok"].Errors)
+	assert.Equal(t, r.Iterations, r.Requests["ok"].Latency.Count())
+	assert.True(t, r.Requests["ok"].Throughput > 0)
+	assert.Equal(t, map[int]int{http.StatusInternalServerError: r.Iterations}, r.Requests["error"].Statuses)
+	assert.Equal(t, map[string]int{"Invalid status code 500 Internal Server Error": r.Iterations}, r.Requests["error"].Errors)
+	assert.Equal(t, 0, r.Requests["skipped"].Count)
+	assert.Equal(t, r.Iterations, r.Requests["skipped"].Skipped)
+}
+
+func TestLoadGeneratorRate(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("test", MethodGet, s.URL))
+
+	// Run
+	r, e := NewLoadGenerator(NewGozzle(), reqSet).SetConcurrency(4).SetDuration(500 * time.Millisecond).SetRate(20).Run()
+	assert.NoError(t, e)
+
+	// Assert
+	assert.True(t, r.Iterations >= 5 && r.Iterations <= 11, r.Iterations)
+
+	// Invalid
+	for _, rate := range []float64{2e9, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, e = NewLoadGenerator(NewGozzle(), reqSet).SetRate(rate).Run()
+		assert.True(t, errors.Is(e, ErrInvalidRate), rate)
+	}
+}
+
+func TestLoadGeneratorStop(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("test", MethodGet, s.URL))
+	l := NewLoadGenerator(NewGozzle(), reqSet).SetDuration(time.Minute)
+
+	// Stop
+	time.AfterFunc(50*time.Millisecond, l.Stop)
+	r, e := l.Run()
+	assert.NoError(t, e)
+
+	// Assert
+	assert.True(t, r.Duration < time.Second)
+	assert.True(t, r.Iterations > 0)
+}
+
+func TestLoadGeneratorDuplicateNames(t *testing.T) {
+	// Initialize
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	defer s.Close()
+	reqSet := NewOrderedRequestSet().SetDuplicateNamePolicy(DuplicateNameError).
+		AddRequest(NewRequest("test", MethodGet, s.URL)).
+		AddRequest(NewRequest("test", MethodGet, s.URL))
+
+	// Run
+	r, e := NewLoadGenerator(NewGozzle(), reqSet).SetDuration(50 * time.Millisecond).Run()
+	assert.NoError(t, e)
+
+	// Assert
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+	assert.True(t, r.Requests["test"].Count > 0)
+	assert.Equal(t, r.Requests["test"].Count, r.Requests["test"].Errors["test: Duplicate name"])
+	assert.Equal(t, 0, r.Requests["test"].Latency.Count())
+}
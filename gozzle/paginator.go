@@ -0,0 +1,445 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Variables
+var (
+	ErrInvalidItems  = errors.New("Invalid items")
+	regexpLinkHeader = regexp.MustCompile(`<([^>]*)>\s*((?:;\s*[^;,]*)*)`)
+)
+
+// PaginationStrategy represents a way of building the request of the next page
+type PaginationStrategy interface {
+	// Next returns the request of the page following the provided one or nil if there's none
+	Next(req Request, resp Response) (Request, error)
+}
+
+// IndexedPaginationStrategy represents a pagination strategy able to build the request of any page without the
+// previous response, which allows fetching pages concurrently
+type IndexedPaginationStrategy interface {
+	PaginationStrategy
+	// Page returns the request of the page at the provided index, the first page having index 0
+	Page(first Request, index int) Request
+}
+
+// Paginator represents an iterator over the pages of a list endpoint
+type Paginator interface {
+	// Next returns the next page or io.EOF once there's none. Returned pages must be closed.
+	Next() (Response, error)
+	// NextItem decodes the next item into v or returns io.EOF once there's none
+	NextItem(v interface{}) error
+	// SetConcurrency sets the number of pages fetched at once with indexed pagination strategies. Default is 1.
+	SetConcurrency(n int) Paginator
+	// SetItemsPath sets the JSON path of the items in the page body. Default is the body itself.
+	SetItemsPath(p string) Paginator
+	// SetMaxPages sets the max number of pages fetched. A value <= 0 means there's no limit.
+	SetMaxPages(n int) Paginator
+}
+
+// NewPaginator creates a new paginator fetching pages through gozzle, starting with the provided request
+// With an indexed pagination strategy, pagination stops at the first page without items.
+func NewPaginator(g Gozzle, first Request, s PaginationStrategy) Paginator {
+	return &paginator{
+		concurrency: 1,
+		first:       first,
+		gozzle:      g,
+		next:        first,
+		strategy:    s,
+	}
+}
+
+type paginator struct {
+	concurrency int
+	done        bool
+	first       Request
+	gozzle      Gozzle
+	items       []json.RawMessage
+	itemsPath   string
+	maxPages    int
+	next        Request
+	pages       []page
+	pagesCount  int
+	strategy    PaginationStrategy
+}
+
+type page struct {
+	err  error
+	resp Response
+}
+
+// SetConcurrency implements the Paginator interface
+func (p *paginator) SetConcurrency(n int) Paginator {
+	if n < 1 {
+		n = 1
+	}
+	p.concurrency = n
+	return p
+}
+
+// SetItemsPath implements the Paginator interface
+func (p *paginator) SetItemsPath(path string) Paginator {
+	p.itemsPath = path
+	return p
+}
+
+// SetMaxPages implements the Paginator interface
+func (p *paginator) SetMaxPages(n int) Paginator {
+	p.maxPages = n
+	return p
+}
+
+// Next implements the Paginator interface
+func (p *paginator) Next() (Response, error) {
+	// Fetch pages
+	if len(p.pages) == 0 && !p.done {
+		if s, ok := p.strategy.(IndexedPaginationStrategy); ok {
+			p.fetchIndexed(s)
+		} else {
+			p.fetch()
+		}
+	}
+
+	// No more pages
+	if len(p.pages) == 0 {
+		return nil, io.EOF
+	}
+
+	// Return next page
+	pg := p.pages[0]
+	p.pages = p.pages[1:]
+	return pg.resp, pg.err
+}
+
+// NextItem implements the Paginator interface
+func (p *paginator) NextItem(v interface{}) error {
+	for len(p.items) == 0 {
+		// Get next page
+		resp, e := p.Next()
+		if e != nil {
+			if resp != nil {
+				resp.Close()
+			}
+			return e
+		}
+
+		// Get items
+		p.items, e = p.pageItems(resp)
+		resp.Close()
+		if e != nil {
+			return e
+		}
+	}
+
+	// Decode item
+	i := p.items[0]
+	p.items = p.items[1:]
+	return json.Unmarshal(i, v)
+}
+
+func (p *paginator) remainingPages() int {
+	if p.maxPages <= 0 {
+		return -1
+	}
+	return p.maxPages - p.pagesCount
+}
+
+func (p *paginator) exec(reqs ...Request) []Response {
+	// Create request set
+	reqSet := NewRequestSet()
+	for _, r := range reqs {
+		reqSet.AddRequest(r)
+	}
+
+	// Execute requests
+	respSet := p.gozzle.Exec(reqSet)
+	var resps []Response
+	for _, r := range reqs {
+		resps = append(resps, respSet.GetResponse(r.Name()))
+	}
+	p.pagesCount += len(reqs)
+	return resps
+}
+
+func (p *paginator) fetch() {
+	// No more pages
+	if p.next == nil || p.remainingPages() == 0 {
+		p.done = true
+		return
+	}
+
+	// Execute request
+	req := p.next
+	resp := p.exec(req)[0]
+
+	// Request has not been sent
+	if resp == nil || resp.State() == ResponseStateSkipped {
+		p.done = true
+		return
+	}
+
+	// Response is invalid
+	if errs := resp.Errors(); len(errs) > 0 {
+		p.done = true
+		p.pages = append(p.pages, page{err: errs[0], resp: resp})
+		return
+	}
+
+	// Get next request
+	var e error
+	if p.next, e = p.strategy.Next(req, resp); e != nil {
+		p.done = true
+		p.pages = append(p.pages, page{err: e, resp: resp})
+		return
+	}
+	p.pages = append(p.pages, page{resp: resp})
+}
+
+func (p *paginator) fetchIndexed(s IndexedPaginationStrategy) {
+	// Get number of pages to fetch
+	n := p.concurrency
+	if r := p.remainingPages(); r == 0 {
+		p.done = true
+		return
+	} else if r > 0 && r < n {
+		n = r
+	}
+
+	// Create requests
+	var reqs []Request
+	for i := 0; i < n; i++ {
+		idx := p.pagesCount + i
+		reqs = append(reqs, s.Page(p.first, idx).SetName(fmt.Sprintf("%s#%d", p.first.Name(), idx)))
+	}
+
+	// Execute requests
+	resps := p.exec(reqs...)
+
+	// Loop through responses
+	for _, resp := range resps {
+		// Pagination is over
+		if p.done {
+			if resp != nil {
+				resp.Close()
+			}
+			continue
+		}
+
+		// Request has not been sent
+		if resp == nil || resp.State() == ResponseStateSkipped {
+			p.done = true
+			continue
+		}
+
+		// Response is invalid
+		if errs := resp.Errors(); len(errs) > 0 {
+			p.done = true
+			p.pages = append(p.pages, page{err: errs[0], resp: resp})
+			continue
+		}
+
+		// Page is empty
+		items, e := p.pageItems(resp)
+		if e != nil {
+			p.done = true
+			p.pages = append(p.pages, page{err: e, resp: resp})
+			continue
+		} else if len(items) == 0 {
+			p.done = true
+			resp.Close()
+			continue
+		}
+		p.pages = append(p.pages, page{resp: resp})
+	}
+
+	// Max pages has been reached
+	if p.remainingPages() == 0 {
+		p.done = true
+	}
+}
+
+func (p *paginator) pageItems(resp Response) (items []json.RawMessage, e error) {
+	// Read body
+	var b []byte
+	if b, e = resp.Body(); e != nil {
+		return
+	}
+
+	// Decode body
+	var d interface{}
+	if d, e = decodeJSON(b); e != nil {
+		return
+	}
+
+	// Get items
+	v, ok := jsonPath(d, p.itemsPath)
+	if !ok || v == nil {
+		return
+	}
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, ErrInvalidItems
+	}
+
+	// Encode items
+	for _, i := range a {
+		var r []byte
+		if r, e = json.Marshal(i); e != nil {
+			return
+		}
+		items = append(items, r)
+	}
+	return
+}
+
+// LinkHeaderPagination creates a pagination strategy following the RFC 5988 Link header with rel="next"
+func LinkHeaderPagination() PaginationStrategy {
+	return linkHeaderPagination{}
+}
+
+type linkHeaderPagination struct{}
+
+// Next implements the PaginationStrategy interface
+func (linkHeaderPagination) Next(req Request, resp Response) (Request, error) {
+	// Get next link
+	var l string
+	for _, h := range resp.Header()["Link"] {
+		for _, m := range regexpLinkHeader.FindAllStringSubmatch(h, -1) {
+			if linkRelIsNext(m[2]) {
+				l = m[1]
+				break
+			}
+		}
+		if l != "" {
+			break
+		}
+	}
+
+	// No next link
+	if l == "" {
+		return nil, nil
+	}
+
+	// Resolve link
+	u, e := url.Parse(l)
+	if e != nil {
+		return nil, e
+	}
+	if !u.IsAbs() {
+		var b *url.URL
+		if b, e = url.Parse(req.FullPath()); e != nil {
+			return nil, e
+		}
+		u = b.ResolveReference(u)
+	}
+	return req.Clone().SetPath(u.String()).SetQuery(map[string]string{}), nil
+}
+
+// linkRelIsNext checks whether link parameters such as `; rel="next last"; title="test"` contain the next relation
+func linkRelIsNext(params string) bool {
+	for _, p := range strings.Split(params, ";") {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+			continue
+		}
+		for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), "\"")) {
+			if strings.EqualFold(r, "next") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CursorPagination creates a pagination strategy reading the cursor of the next page at the provided JSON path of
+// the response body and setting it as the provided query parameter. Pagination stops when the cursor is empty.
+func CursorPagination(path, param string) PaginationStrategy {
+	return cursorPagination{param: param, path: path}
+}
+
+type cursorPagination struct {
+	param string
+	path  string
+}
+
+// Next implements the PaginationStrategy interface
+func (s cursorPagination) Next(req Request, resp Response) (Request, error) {
+	// Read body
+	b, e := resp.Body()
+	if e != nil {
+		return nil, e
+	}
+
+	// Decode body
+	d, e := decodeJSON(b)
+	if e != nil {
+		return nil, e
+	}
+
+	// Get cursor
+	v, ok := jsonPath(d, s.path)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	var c string
+	switch t := v.(type) {
+	case string:
+		c = t
+	case json.Number:
+		c = t.String()
+	default:
+		return nil, fmt.Errorf("Invalid cursor %v", v)
+	}
+	if strings.TrimSpace(c) == "" {
+		return nil, nil
+	}
+	return req.Clone().AddQuery(s.param, c), nil
+}
+
+// PagePagination creates a pagination strategy setting the page number, starting at start, as the provided query
+// parameter
+func PagePagination(param string, start int) IndexedPaginationStrategy {
+	return offsetPagination{param: param, start: start, step: 1}
+}
+
+// OffsetPagination creates a pagination strategy setting the offset, starting at start and increased by step, as
+// the provided query parameter
+func OffsetPagination(param string, start, step int) IndexedPaginationStrategy {
+	return offsetPagination{param: param, start: start, step: step}
+}
+
+type offsetPagination struct {
+	param string
+	start int
+	step  int
+}
+
+// Page implements the IndexedPaginationStrategy interface
+func (s offsetPagination) Page(first Request, index int) Request {
+	return first.Clone().AddQuery(s.param, strconv.Itoa(s.start+index*s.step))
+}
+
+// Next implements the PaginationStrategy interface
+func (s offsetPagination) Next(req Request, resp Response) (Request, error) {
+	v := s.start
+	if q := req.GetQuery(s.param); q != "" {
+		var e error
+		if v, e = strconv.Atoi(q); e != nil {
+			return nil, e
+		}
+		v += s.step
+	}
+	return req.Clone().AddQuery(s.param, strconv.Itoa(v)), nil
+}
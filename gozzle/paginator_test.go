@@ -0,0 +1,154 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPaginatedServer(n int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Get page
+		p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			p, _ = strconv.Atoi(c)
+		}
+
+		// Add link header
+		if p < n-1 {
+			w.Header().Set("Link", fmt.Sprintf("</items?page=%d>; rel=\"next last\", </items?page=0>; rel=\"first\"", p+1))
+		}
+
+		// Write body
+		if p >= n {
+			w.Write([]byte("{\"items\":[]}"))
+			return
+		}
+		var next string
+		if p < n-1 {
+			next = strconv.Itoa(p + 1)
+		}
+		w.Write([]byte(fmt.Sprintf("{\"items\":[%d,%d],\"next\":%q}", 2*p, 2*p+1, next)))
+	}))
+}
+
+func paginatorItems(t *testing.T, p Paginator) (items []int) {
+	for {
+		var i int
+		e := p.NextItem(&i)
+		if e == io.EOF {
+			return
+		}
+		assert.NoError(t, e)
+		items = append(items, i)
+	}
+}
+
+func TestPaginatorLinkHeader(t *testing.T) {
+	// Create server
+	server := newPaginatedServer(3)
+	defer server.Close()
+
+	// Assert
+	p := NewPaginator(NewGozzle(), NewRequest("test", MethodGet, server.URL+"/items"), LinkHeaderPagination()).SetItemsPath("items")
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, paginatorItems(t, p))
+}
+
+func TestPaginatorCursor(t *testing.T) {
+	// Create server
+	server := newPaginatedServer(3)
+	defer server.Close()
+
+	// Assert
+	p := NewPaginator(NewGozzle(), NewRequest("test", MethodGet, server.URL), CursorPagination("$.next", "cursor")).
+		SetItemsPath("$.items").
+		SetMaxPages(2)
+	assert.Equal(t, []int{0, 1, 2, 3}, paginatorItems(t, p))
+}
+
+func TestPaginatorCursorPrecision(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := r.URL.Query().Get("cursor"); c != "" {
+			w.Write([]byte(`{"items":[` + c + `]}`))
+			return
+		}
+		w.Write([]byte(`{"items":[1],"next":9007199254740993}`))
+	}))
+	defer server.Close()
+
+	// Assert
+	p := NewPaginator(NewGozzle(), NewRequest("test", MethodGet, server.URL), CursorPagination("$.next", "cursor")).
+		SetItemsPath("$.items")
+	var items []int64
+	for {
+		var i int64
+		e := p.NextItem(&i)
+		if e == io.EOF {
+			break
+		}
+		assert.NoError(t, e)
+		items = append(items, i)
+	}
+	assert.Equal(t, []int64{1, 9007199254740993}, items)
+}
+
+func TestPaginatorPage(t *testing.T) {
+	// Create server
+	server := newPaginatedServer(5)
+	defer server.Close()
+
+	// Concurrency
+	p := NewPaginator(NewGozzle(), NewRequest("test", MethodGet, server.URL), PagePagination("page", 0)).
+		SetItemsPath("items").
+		SetConcurrency(2)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, paginatorItems(t, p))
+
+	// Max pages
+	p = NewPaginator(NewGozzle(), NewRequest("test", MethodGet, server.URL), PagePagination("page", 1)).
+		SetItemsPath("items").
+		SetConcurrency(2).
+		SetMaxPages(3)
+	var n int
+	for {
+		resp, e := p.Next()
+		if e == io.EOF {
+			break
+		}
+		assert.NoError(t, e)
+		resp.Close()
+		n++
+	}
+	assert.Equal(t, 3, n)
+}
+
+func TestOffsetPagination(t *testing.T) {
+	// Initialize
+	s := OffsetPagination("offset", 0, 20)
+	r := NewRequest("test", MethodGet, "/")
+
+	// Assert
+	assert.Equal(t, "/?offset=40", s.Page(r, 2).FullPath())
+	n, e := s.Next(r, nil)
+	assert.NoError(t, e)
+	assert.Equal(t, "/?offset=0", n.FullPath())
+	n, e = s.Next(n, nil)
+	assert.NoError(t, e)
+	assert.Equal(t, "/?offset=20", n.FullPath())
+}
+
+func TestLinkRelIsNext(t *testing.T) {
+	assert.True(t, linkRelIsNext("; rel=next"))
+	assert.True(t, linkRelIsNext("; title=\"a\"; REL=\"prev next\""))
+	assert.False(t, linkRelIsNext("; rel=\"nextpage\""))
+	assert.False(t, linkRelIsNext("; title=next"))
+}
@@ -0,0 +1,192 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Variables
+var (
+	ErrInvalidProxy = errors.New("Invalid proxy")
+	proxySchemes    = map[string]bool{"http": true, "https": true, "socks5": true}
+)
+
+// ProxyConfiguration represents a JSON-friendly proxy configuration
+// Requests go through the proxy of the first rule matching their host, then through URL if set and then through the
+// proxy defined by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables if Environment is true. Otherwise
+// they're sent directly. Proxy URLs use either the http, https or socks5 scheme and default to http. Username and
+// Password authenticate against proxies whose URL has no credentials.
+type ProxyConfiguration struct {
+	Environment bool        `json:"environment"`
+	Password    string      `json:"password"`
+	Rules       []ProxyRule `json:"rules"`
+	URL         string      `json:"url"`
+	Username    string      `json:"username"`
+}
+
+// ProxyRule represents a proxy used for specific hosts
+// Hosts are either host names such as "example.com", patterns such as "*.example.com" matching the subdomains of a
+// domain, or "*" matching every host. An empty URL means requests are sent directly.
+type ProxyRule struct {
+	Hosts []string `json:"hosts"`
+	URL   string   `json:"url"`
+}
+
+type proxy struct {
+	environment func(u *url.URL) (*url.URL, error)
+	rules       []proxyRule
+	url         *url.URL
+}
+
+type proxyRule struct {
+	hosts []string
+	url   *url.URL
+}
+
+type proxyContextKey struct{}
+
+// newProxy parses the proxy configuration
+func newProxy(c ProxyConfiguration) (p *proxy, e error) {
+	// Initialize
+	p = &proxy{}
+	parse := func(s string) (*url.URL, error) {
+		if s == "" {
+			return nil, nil
+		}
+		return parseProxyURL(s, c.Username, c.Password)
+	}
+
+	// Rules
+	for _, r := range c.Rules {
+		pr := proxyRule{}
+		if pr.url, e = parse(r.URL); e != nil {
+			return
+		}
+		for _, h := range r.Hosts {
+			pr.hosts = append(pr.hosts, strings.ToLower(h))
+		}
+		p.rules = append(p.rules, pr)
+	}
+
+	// URL
+	if p.url, e = parse(c.URL); e != nil {
+		return
+	}
+
+	// Environment
+	if c.Environment {
+		p.environment = httpproxy.FromEnvironment().ProxyFunc()
+	}
+	return
+}
+
+func parseProxyURL(s, username, password string) (*url.URL, error) {
+	// Default scheme
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	// Parse
+	u, e := url.Parse(s)
+	if e != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProxy, e)
+	} else if !proxySchemes[u.Scheme] {
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidProxy, u.Scheme)
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidProxy)
+	}
+
+	// Add credentials
+	if u.User == nil && username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	return u, nil
+}
+
+// proxyURL returns the URL of the proxy the request must go through or nil if it must be sent directly
+func (p *proxy) proxyURL(u *url.URL) (*url.URL, error) {
+	// Rules
+	h := strings.ToLower(u.Hostname())
+	for _, r := range p.rules {
+		for _, v := range r.hosts {
+			if matchHost(v, h) {
+				return r.url, nil
+			}
+		}
+	}
+
+	// URL
+	if p.url != nil {
+		return p.url, nil
+	}
+
+	// Environment
+	if p.environment != nil {
+		return p.environment(u)
+	}
+	return nil, nil
+}
+
+func matchHost(pattern, host string) bool {
+	if pattern == "*" {
+		return true
+	} else if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
+
+// proxyFromContext is the transport proxy function
+// Requests sent without gozzle proxy use the proxy defined by the environment variables whereas requests targeting
+// Unix domain sockets never go through proxies.
+func proxyFromContext(r *http.Request) (*url.URL, error) {
+	if _, ok := r.Context().Value(unixSocketContextKey{}).(string); ok {
+		return nil, nil
+	} else if p, ok := r.Context().Value(proxyContextKey{}).(*proxy); ok {
+		return p.proxyURL(r.URL)
+	}
+	return http.ProxyFromEnvironment(r)
+}
+
+// SetProxyConfiguration sets the proxy configuration
+// It can be overridden per request. A nil configuration, which is the default, uses the proxy defined by the
+// environment variables. If the configuration is invalid, requests fail with the error until a valid configuration
+// is set.
+func (g *gozzle) SetProxyConfiguration(c *ProxyConfiguration) Gozzle {
+	g.proxyConfiguration = c
+	g.proxy, g.proxyErr = nil, nil
+	if c != nil {
+		g.proxy, g.proxyErr = newProxy(*c)
+	}
+	return g
+}
+
+// ProxyConfiguration returns the proxy configuration
+func (g *gozzle) ProxyConfiguration() *ProxyConfiguration {
+	return g.proxyConfiguration
+}
+
+// withProxy returns the http request with the proxy it must go through, falling back on the gozzle one
+func (g gozzle) withProxy(req Request, httpReq *http.Request) (*http.Request, error) {
+	// Get proxy
+	p, e := g.proxy, g.proxyErr
+	if req.Proxy() != nil {
+		p, e = newProxy(*req.Proxy())
+	}
+	if e != nil || p == nil {
+		return httpReq, e
+	}
+
+	// Update context
+	return httpReq.WithContext(context.WithValue(httpReq.Context(), proxyContextKey{}, p)), nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit represents a JSON-friendly token bucket configuration
+// Rate is the number of requests allowed per second and Burst the number of requests that can be sent at once.
+// A Rate <= 0 disables the limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// RateLimitConfiguration represents a JSON-friendly rate limiting configuration
+// Hosts keys are either hosts ("example.com:8080"), hostnames ("example.com") or paths of Unix domain sockets.
+// When Adaptive is true, the limit of a host is halved each time it answers with a 429 status code, its
+// Retry-After header is honored, and the limit slowly recovers on successful responses.
+type RateLimitConfiguration struct {
+	Global   RateLimit            `json:"global"`
+	Hosts    map[string]RateLimit `json:"hosts"`
+	Adaptive bool                 `json:"adaptive"`
+}
+
+type rateLimiter struct {
+	adaptive bool
+	global   *tokenBucket
+	hosts    map[string]*tokenBucket
+}
+
+func newRateLimiter(c RateLimitConfiguration) *rateLimiter {
+	// Initialize
+	l := &rateLimiter{
+		adaptive: c.Adaptive,
+		global:   newTokenBucket(c.Global),
+		hosts:    make(map[string]*tokenBucket),
+	}
+
+	// Loop through hosts
+	for h, r := range c.Hosts {
+		if b := newTokenBucket(r); b != nil {
+			l.hosts[h] = b
+		}
+	}
+
+	// Nothing to limit
+	if l.global == nil && len(l.hosts) == 0 {
+		return nil
+	}
+	return l
+}
+
+func (l *rateLimiter) host(httpReq *http.Request) *tokenBucket {
+	if h := requestHost(httpReq); h != httpReq.URL.Host {
+		return l.hosts[h]
+	} else if b, ok := l.hosts[h]; ok {
+		return b
+	}
+	return l.hosts[httpReq.URL.Hostname()]
+}
+
+// wait blocks until the request is allowed to be sent and returns the time spent waiting
+func (l *rateLimiter) wait(httpReq *http.Request) (time.Duration, error) {
+	// No limit
+	if l == nil {
+		return 0, nil
+	}
+
+	// Reserve tokens
+	var d time.Duration
+	var bs []*tokenBucket
+	n := time.Now()
+	for _, b := range []*tokenBucket{l.global, l.host(httpReq)} {
+		if b == nil {
+			continue
+		}
+		bs = append(bs, b)
+		if v := b.reserve(n); v > d {
+			d = v
+		}
+	}
+
+	// Wait
+	if d <= 0 {
+		return 0, nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-httpReq.Context().Done():
+		// Give tokens back so that cancelled requests don't delay the following ones
+		for _, b := range bs {
+			b.refund()
+		}
+		return time.Since(n), httpReq.Context().Err()
+	}
+	return time.Since(n), nil
+}
+
+// feedback adapts the limits based on the response
+func (l *rateLimiter) feedback(httpReq *http.Request, httpResp *http.Response) {
+	// Nothing to adapt
+	if l == nil || !l.adaptive {
+		return
+	}
+
+	// Get bucket
+	b := l.host(httpReq)
+	if b == nil {
+		b = l.global
+	}
+	if b == nil {
+		return
+	}
+
+	// Adapt
+	if httpResp.StatusCode == http.StatusTooManyRequests {
+		b.backOff(time.Now(), retryAfter(httpResp))
+	} else if httpResp.StatusCode >= 200 && httpResp.StatusCode < 300 {
+		b.recover()
+	}
+}
+
+// retryAfter parses the Retry-After header which is either a number of seconds or an http date
+func retryAfter(httpResp *http.Response) time.Duration {
+	v := httpResp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if s, e := strconv.Atoi(v); e == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, e := http.ParseTime(v); e == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+type tokenBucket struct {
+	burst   float64
+	last    time.Time
+	maxRate float64
+	mutex   sync.Mutex
+	rate    float64
+	tokens  float64
+}
+
+func newTokenBucket(r RateLimit) *tokenBucket {
+	// No limit
+	if r.Rate <= 0 {
+		return nil
+	}
+
+	// Burst must allow at least one request
+	if r.Burst < 1 {
+		r.Burst = 1
+	}
+	return &tokenBucket{
+		burst:   float64(r.Burst),
+		maxRate: r.Rate,
+		rate:    r.Rate,
+		tokens:  float64(r.Burst),
+	}
+}
+
+// refill must be called with the mutex locked
+func (b *tokenBucket) refill(n time.Time) {
+	if b.last.IsZero() {
+		b.last = n
+	} else if n.After(b.last) {
+		b.tokens += n.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = n
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait before using it
+func (b *tokenBucket) reserve(n time.Time) (d time.Duration) {
+	// Lock
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Take token
+	b.refill(n)
+	b.tokens--
+
+	// The bucket may be paused
+	if b.last.After(n) {
+		d = b.last.Sub(n)
+	}
+
+	// Tokens are missing
+	if b.tokens < 0 {
+		d += time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return
+}
+
+// refund gives back a token that has been reserved but not used
+func (b *tokenBucket) refund() {
+	// Lock
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Give token back
+	if b.tokens++; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// backOff halves the rate and pauses the bucket for the provided duration
+func (b *tokenBucket) backOff(n time.Time, pause time.Duration) {
+	// Lock
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Halve rate
+	b.refill(n)
+	if b.rate /= 2; b.rate < b.maxRate/16 {
+		b.rate = b.maxRate / 16
+	}
+
+	// Pause
+	if pause > 0 {
+		if b.tokens > 0 {
+			b.tokens = 0
+		}
+		if p := n.Add(pause); p.After(b.last) {
+			b.last = p
+		}
+	}
+}
+
+// recover increases the rate back towards its configured value
+func (b *tokenBucket) recover() {
+	// Lock
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// Increase rate
+	if b.rate += b.maxRate / 10; b.rate > b.maxRate {
+		b.rate = b.maxRate
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	// Initialize
+	n := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2})
+
+	// Burst
+	assert.Equal(t, time.Duration(0), b.reserve(n))
+	assert.Equal(t, time.Duration(0), b.reserve(n))
+
+	// Wait
+	assert.Equal(t, 100*time.Millisecond, b.reserve(n))
+	assert.Equal(t, 200*time.Millisecond, b.reserve(n))
+
+	// Refund
+	b.refund()
+	assert.Equal(t, 200*time.Millisecond, b.reserve(n))
+
+	// Refill
+	assert.Equal(t, time.Duration(0), b.reserve(n.Add(2*time.Second)))
+
+	// No limit
+	assert.Nil(t, newTokenBucket(RateLimit{}))
+}
+
+func TestTokenBucketAdaptive(t *testing.T) {
+	// Initialize
+	n := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 1})
+
+	// Back off
+	b.backOff(n, time.Second)
+	assert.Equal(t, 5.0, b.rate)
+	assert.Equal(t, time.Second+200*time.Millisecond, b.reserve(n))
+
+	// Floor
+	for i := 0; i < 10; i++ {
+		b.backOff(n, 0)
+	}
+	assert.Equal(t, 10.0/16, b.rate)
+
+	// Recover
+	for i := 0; i < 20; i++ {
+		b.recover()
+	}
+	assert.Equal(t, 10.0, b.rate)
+}
+
+func TestRateLimiterHost(t *testing.T) {
+	// Initialize
+	l := newRateLimiter(RateLimitConfiguration{Hosts: map[string]RateLimit{
+		"a.com":      {Rate: 1},
+		"b.com:8080": {Rate: 2},
+		"/a.sock":    {Rate: 3},
+	}})
+	u1, _ := url.Parse("http://a.com:80/")
+	u2, _ := url.Parse("http://b.com:8080/")
+	u3, _ := url.Parse("http://b.com/")
+	u4, _ := url.Parse("http://" + unixSocketHost + "/")
+	unix := func(socket string) *http.Request {
+		return (&http.Request{URL: u4}).WithContext(context.WithValue(context.Background(), unixSocketContextKey{}, socket))
+	}
+
+	// Assert
+	assert.Equal(t, 1.0, l.host(&http.Request{URL: u1}).rate)
+	assert.Equal(t, 2.0, l.host(&http.Request{URL: u2}).rate)
+	assert.Nil(t, l.host(&http.Request{URL: u3}))
+	assert.Equal(t, 3.0, l.host(unix("/a.sock")).rate)
+	assert.Nil(t, l.host(unix("/b.sock")))
+	assert.Nil(t, newRateLimiter(RateLimitConfiguration{}))
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryAfter(&http.Response{Header: http.Header{}}))
+	assert.Equal(t, 2*time.Second, retryAfter(&http.Response{Header: http.Header{"Retry-After": []string{"2"}}}))
+}
+
+func TestExecRateLimit(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Create request set
+	n := 4
+	reqSet := NewRequestSet()
+	for i := 0; i < n; i++ {
+		reqSet.AddRequest(NewRequest(fmt.Sprintf("test%d", i), MethodGet, server.URL))
+	}
+
+	// Create gozzle
+	g := NewGozzleFromConfiguration(Configuration{RateLimit: RateLimitConfiguration{
+		Global: RateLimit{Rate: 20, Burst: 1},
+	}})
+
+	// Execute requests
+	s := time.Now()
+	respSet := g.Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.True(t, time.Since(s) >= 150*time.Millisecond)
+	var max time.Duration
+	for _, name := range respSet.Names() {
+		if w := respSet.GetResponse(name).Timing().QueueWait; w > max {
+			max = w
+		}
+	}
+	assert.True(t, max >= 140*time.Millisecond)
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	// Initialize
+	l := newRateLimiter(RateLimitConfiguration{Global: RateLimit{Rate: 10, Burst: 1}})
+	httpReq, _ := http.NewRequest(MethodGet, "http://localhost", nil)
+	_, e := l.wait(httpReq)
+	assert.NoError(t, e)
+
+	// Cancel mid-wait
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	d, e := l.wait(httpReq.WithContext(ctx))
+	assert.Equal(t, context.Canceled, e)
+	assert.True(t, d < 100*time.Millisecond, d)
+
+	// The token has been given back
+	s := time.Now()
+	_, e = l.wait(httpReq)
+	assert.NoError(t, e)
+	assert.True(t, time.Since(s) < 150*time.Millisecond, time.Since(s))
+}
@@ -0,0 +1,158 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Redirect modes
+const (
+	// Redirects are followed whatever their host
+	RedirectFollow string = "follow"
+	// Redirects are not followed and the redirect response is returned
+	RedirectNone string = "none"
+	// Redirects are followed as long as they target the host of the request, otherwise the redirect response is
+	// returned
+	RedirectSameHost string = "same-host"
+)
+
+// Sensitive headers modes
+const (
+	// Sensitive headers are sent to every redirect target
+	SensitiveHeadersKeep string = "keep"
+	// Sensitive headers are never sent to redirect targets
+	SensitiveHeadersDrop string = "drop"
+)
+
+// Constants
+const (
+	defaultRedirectMaxHops = 10
+)
+
+// Variables
+var (
+	ErrTooManyRedirects = errors.New("Too many redirects")
+	sensitiveHeaders    = []string{"Authorization", "Cookie", "Cookie2", "Proxy-Authorization", "Www-Authenticate"}
+)
+
+// RedirectPolicy represents a JSON-friendly redirect policy
+// Mode is either RedirectFollow (default), RedirectNone or RedirectSameHost. Following more than MaxHops redirects,
+// 10 by default, fails with ErrTooManyRedirects. SensitiveHeaders is either SensitiveHeadersKeep, SensitiveHeadersDrop
+// or empty (default), in which case sensitive headers such as Authorization are only sent to redirect targets on the
+// same domain or one of its subdomains. Cookies stored in the cookie jar are not affected.
+type RedirectPolicy struct {
+	MaxHops          int    `json:"max_hops"`
+	Mode             string `json:"mode"`
+	SensitiveHeaders string `json:"sensitive_headers"`
+}
+
+// Redirect represents a redirect response received before the final response
+type Redirect struct {
+	Location   string
+	Status     string
+	StatusCode int
+	URL        string
+}
+
+// SetRedirectPolicy sets the policy deciding which redirects are followed
+// It can be overridden per request. A nil policy, which is the default, follows up to 10 redirects.
+func (g *gozzle) SetRedirectPolicy(p *RedirectPolicy) Gozzle {
+	g.redirectPolicy = p
+	return g
+}
+
+// RedirectPolicy returns the policy deciding which redirects are followed
+func (g *gozzle) RedirectPolicy() *RedirectPolicy {
+	return g.redirectPolicy
+}
+
+// requestRedirectPolicy returns the request redirect policy, falling back on the gozzle one
+func (g gozzle) requestRedirectPolicy(req Request) *RedirectPolicy {
+	if req.RedirectPolicy() != nil {
+		return req.RedirectPolicy()
+	}
+	return g.redirectPolicy
+}
+
+// checkRedirect returns the function deciding whether the http client follows a redirect of the request
+func (p *RedirectPolicy) checkRedirect(original Request) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		return p.check(original, req, via)
+	}
+}
+
+func (p *RedirectPolicy) check(original Request, req *http.Request, via []*http.Request) error {
+	// Initialize
+	var mode, headers string
+	maxHops := defaultRedirectMaxHops
+	if p != nil {
+		mode, headers = p.Mode, p.SensitiveHeaders
+		if p.MaxHops > 0 {
+			maxHops = p.MaxHops
+		}
+	}
+
+	// Check mode
+	switch mode {
+	case RedirectNone:
+		return http.ErrUseLastResponse
+	case RedirectSameHost:
+		if req.URL.Host != via[0].URL.Host {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	// Check hops
+	if len(via) > maxHops {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, maxHops)
+	}
+
+	// Update sensitive headers
+	// Kept headers are the ones of the original request only since the first http request also contains the cookies
+	// of the jar which must not be sent to other hosts
+	for _, k := range sensitiveHeaders {
+		switch headers {
+		case SensitiveHeadersKeep:
+			for hk, hv := range original.Headers() {
+				if http.CanonicalHeaderKey(hk) == k {
+					req.Header.Set(k, hv)
+				}
+			}
+		case SensitiveHeadersDrop:
+			req.Header.Del(k)
+		}
+	}
+	return nil
+}
+
+// redirects returns the redirect responses that led to the response, in order
+func redirects(httpResp *http.Response) (rs []Redirect) {
+	// Loop through redirect responses
+	for r := httpResp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		rd := Redirect{
+			Location:   r.Response.Header.Get("Location"),
+			Status:     r.Response.Status,
+			StatusCode: r.Response.StatusCode,
+		}
+		if r.Response.Request != nil {
+			rd.URL = r.Response.Request.URL.String()
+		}
+		rs = append(rs, rd)
+	}
+
+	// Reverse
+	for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+		rs[i], rs[j] = rs[j], rs[i]
+	}
+	return
+}
+
+// Redirects returns the redirect responses received before the response, in order
+func (r *response) Redirects() []Redirect {
+	return r.redirects
+}
@@ -0,0 +1,122 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecRedirectPolicy(t *testing.T) {
+	// Initialize
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer other.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusMovedPermanently)
+		case "/away":
+			http.Redirect(w, r, other.URL+"/echo", http.StatusFound)
+		default:
+			w.Write([]byte(r.Header.Get("Authorization")))
+		}
+	}))
+	defer s.Close()
+	exec := func(g Gozzle, path string, p *RedirectPolicy) Response {
+		return g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, s.URL+path).
+			AddHeader("Authorization", "secret").
+			SetRedirectPolicy(p))).GetResponse("test")
+	}
+
+	// Default
+	g := NewGozzle()
+	resp := exec(g, "/a", nil)
+	assert.Empty(t, resp.Errors())
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, []Redirect{
+		{Location: "/b", Status: "302 Found", StatusCode: http.StatusFound, URL: s.URL + "/a"},
+		{Location: "/c", Status: "301 Moved Permanently", StatusCode: http.StatusMovedPermanently, URL: s.URL + "/b"},
+	}, resp.Redirects())
+
+	// None
+	resp = exec(g, "/a", &RedirectPolicy{Mode: RedirectNone})
+	assert.Equal(t, http.StatusFound, resp.StatusCode())
+	assert.Empty(t, resp.Redirects())
+
+	// Gozzle policy overridden by the request
+	g.SetRedirectPolicy(&RedirectPolicy{Mode: RedirectNone})
+	assert.Equal(t, http.StatusFound, exec(g, "/a", nil).StatusCode())
+	assert.Equal(t, http.StatusOK, exec(g, "/a", &RedirectPolicy{Mode: RedirectFollow}).StatusCode())
+
+	// Same host
+	g.SetRedirectPolicy(&RedirectPolicy{Mode: RedirectSameHost})
+	assert.Equal(t, http.StatusOK, exec(g, "/a", nil).StatusCode())
+	resp = exec(g, "/away", nil)
+	assert.Equal(t, http.StatusFound, resp.StatusCode())
+	assert.Empty(t, resp.Redirects())
+
+	// Max hops
+	resp = exec(g, "/a", &RedirectPolicy{MaxHops: 1})
+	assert.Len(t, resp.Errors(), 1)
+	assert.True(t, errors.Is(resp.Errors()[0], ErrTooManyRedirects))
+	assert.Equal(t, http.StatusOK, exec(g, "/a", &RedirectPolicy{MaxHops: 2}).StatusCode())
+
+	// Sensitive headers
+	b, _ := exec(g, "/a", &RedirectPolicy{SensitiveHeaders: SensitiveHeadersDrop}).Body()
+	assert.Equal(t, "", string(b))
+	b, _ = exec(g, "/away", &RedirectPolicy{SensitiveHeaders: SensitiveHeadersKeep}).Body()
+	assert.Equal(t, "secret", string(b))
+	b, _ = exec(g, "/a", &RedirectPolicy{}).Body()
+	assert.Equal(t, "secret", string(b))
+}
+
+func TestExecRedirectSensitiveHeadersKeepCookieJar(t *testing.T) {
+	// Initialize
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization") + ";" + r.Header.Get("Cookie")))
+	}))
+	defer other.Close()
+	_, port, _ := net.SplitHostPort(other.Listener.Addr().String())
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		case "/away":
+			http.Redirect(w, r, "http://"+net.JoinHostPort("other.test", port)+"/echo", http.StatusFound)
+		}
+	}))
+	defer s.Close()
+	j, e := NewMemoryCookieJar()
+	assert.NoError(t, e)
+	g := NewGozzle().
+		SetCookieJar(j).
+		SetDialConfiguration(DialConfiguration{Hosts: map[string]string{"other.test": "127.0.0.1"}})
+
+	// Execute
+	g.Exec(NewRequestSet().AddRequest(NewRequest("login", MethodGet, s.URL+"/login")))
+	respSet := g.Exec(NewRequestSet().AddRequest(NewRequest("away", MethodGet, s.URL+"/away").
+		AddHeader("authorization", "secret").
+		SetRedirectPolicy(&RedirectPolicy{SensitiveHeaders: SensitiveHeadersKeep})))
+
+	// Assert
+	b, e := respSet.GetResponse("away").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "secret;", string(b))
+}
+
+func TestNewGozzleFromConfigurationRedirect(t *testing.T) {
+	assert.Nil(t, NewGozzleFromConfiguration(Configuration{}).RedirectPolicy())
+	p := &RedirectPolicy{MaxHops: 3, Mode: RedirectSameHost, SensitiveHeaders: SensitiveHeadersKeep}
+	assert.Equal(t, p, NewGozzleFromConfiguration(Configuration{Redirect: p}).RedirectPolicy())
+}
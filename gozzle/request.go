@@ -14,6 +14,9 @@ import (
 	"github.com/asticode/go-toolbox/array"
 )
 
+// RawBody represents a request body sent as is
+type RawBody []byte
+
 // Request represents a request sendable by gozzle
 type Request interface {
 	Name() string
@@ -38,9 +41,31 @@ type Request interface {
 	SetBodyReader(reader io.Reader) Request
 	BeforeHandler() func(r Request) bool
 	SetBeforeHandler(f func(r Request) bool) Request
+	BeforeHandlerE() func(r Request) error
+	SetBeforeHandlerE(f func(r Request) error) Request
 	AfterHandler() func(req Request, resp Response)
 	SetAfterHandler(f func(req Request, resp Response)) Request
 	FullPath() string
+	Hedging() *Hedging
+	SetHedging(h *Hedging) Request
+	SuccessPolicy() SuccessPolicy
+	SetSuccessPolicy(p SuccessPolicy) Request
+	MaxSizeBody() int
+	SetMaxSizeBody(maxSizeBody int) Request
+	BodyLimitMode() string
+	SetBodyLimitMode(m string) Request
+	Compression() *Compression
+	SetCompression(c *Compression) Request
+	RedirectPolicy() *RedirectPolicy
+	SetRedirectPolicy(p *RedirectPolicy) Request
+	Proxy() *ProxyConfiguration
+	SetProxy(c *ProxyConfiguration) Request
+	Expectations() []Expectation
+	AddExpectation(e ...Expectation) Request
+	SetExpectations(e []Expectation) Request
+	Extractors() []Extractor
+	AddExtractor(e ...Extractor) Request
+	Clone() Request
 }
 
 // NewRequest creates a new request
@@ -55,15 +80,25 @@ func NewRequest(name string, method string, path string) Request {
 }
 
 type request struct {
-	name          string
-	method        string
-	path          string
-	headers       map[string]string
-	query         map[string]string
-	body          interface{}
-	bodyReader    io.Reader
-	beforeHandler func(r Request) bool
-	afterHandler  func(r Request, resp Response)
+	name           string
+	method         string
+	path           string
+	headers        map[string]string
+	query          map[string]string
+	body           interface{}
+	bodyReader     io.Reader
+	beforeHandler  func(r Request) bool
+	beforeHandlerE func(r Request) error
+	afterHandler   func(r Request, resp Response)
+	hedging        *Hedging
+	successPolicy  SuccessPolicy
+	maxSizeBody    int
+	bodyLimitMode  string
+	compression    *Compression
+	proxy          *ProxyConfiguration
+	redirectPolicy *RedirectPolicy
+	expectations   []Expectation
+	extractors     []Extractor
 }
 
 // Name returns the request name
@@ -161,6 +196,8 @@ func (r *request) Body() interface{} {
 }
 
 // SetBody sets the whole request body
+// A RawBody is sent as is, other bodies are marshaled to XML if the Content-Type header is "application/xml" and to
+// JSON otherwise
 func (r *request) SetBody(b interface{}) Request {
 	r.body = b
 	return r
@@ -188,6 +225,19 @@ func (r *request) BeforeHandler() func(r Request) bool {
 	return r.beforeHandler
 }
 
+// SetBeforeHandlerE sets the handler executed before sending the request, after the one set with SetBeforeHandler
+// Returning an error created with Skip skips the request for the provided reason whereas returning any other error
+// fails the request with this error.
+func (r *request) SetBeforeHandlerE(f func(r Request) error) Request {
+	r.beforeHandlerE = f
+	return r
+}
+
+// BeforeHandlerE returns the handler executed before sending the request that can return an error
+func (r *request) BeforeHandlerE() func(r Request) error {
+	return r.beforeHandlerE
+}
+
 // SetAfterHandler sets the handler executed after sending the request
 func (r *request) SetAfterHandler(f func(req Request, resp Response)) Request {
 	r.afterHandler = f
@@ -199,6 +249,132 @@ func (r *request) AfterHandler() func(req Request, resp Response) {
 	return r.afterHandler
 }
 
+// Hedging returns the hedging configuration
+func (r *request) Hedging() *Hedging {
+	return r.hedging
+}
+
+// SetHedging sets the hedging configuration
+// Only idempotent requests should be hedged
+func (r *request) SetHedging(h *Hedging) Request {
+	r.hedging = h
+	return r
+}
+
+// SuccessPolicy returns the policy deciding whether the response is successful
+func (r *request) SuccessPolicy() SuccessPolicy {
+	return r.successPolicy
+}
+
+// SetSuccessPolicy sets the policy deciding whether the response is successful
+// It overrides the gozzle success policy
+func (r *request) SetSuccessPolicy(p SuccessPolicy) Request {
+	r.successPolicy = p
+	return r
+}
+
+// MaxSizeBody returns the max size of the response body
+func (r *request) MaxSizeBody() int {
+	return r.maxSizeBody
+}
+
+// SetMaxSizeBody sets the max size of the response body
+// It overrides the gozzle max size body if != 0. A value < 0 means the body size is not limited.
+func (r *request) SetMaxSizeBody(maxSizeBody int) Request {
+	r.maxSizeBody = maxSizeBody
+	return r
+}
+
+// BodyLimitMode returns what happens when the response body is larger than the max size body
+func (r *request) BodyLimitMode() string {
+	return r.bodyLimitMode
+}
+
+// SetBodyLimitMode sets what happens when the response body is larger than the max size body
+// It overrides the gozzle body limit mode if not empty
+func (r *request) SetBodyLimitMode(m string) Request {
+	r.bodyLimitMode = m
+	return r
+}
+
+// Compression returns the compression applied to the request body
+func (r *request) Compression() *Compression {
+	return r.compression
+}
+
+// SetCompression sets the compression applied to the request body
+// It overrides the gozzle compression
+func (r *request) SetCompression(c *Compression) Request {
+	r.compression = c
+	return r
+}
+
+// RedirectPolicy returns the policy deciding which redirects are followed
+func (r *request) RedirectPolicy() *RedirectPolicy {
+	return r.redirectPolicy
+}
+
+// SetRedirectPolicy sets the policy deciding which redirects are followed
+// It overrides the gozzle redirect policy
+func (r *request) SetRedirectPolicy(p *RedirectPolicy) Request {
+	r.redirectPolicy = p
+	return r
+}
+
+// Proxy returns the proxy configuration of the request
+func (r *request) Proxy() *ProxyConfiguration {
+	return r.proxy
+}
+
+// SetProxy sets the proxy configuration of the request
+// It overrides the gozzle proxy configuration. Use an empty configuration to send the request directly.
+func (r *request) SetProxy(c *ProxyConfiguration) Request {
+	r.proxy = c
+	return r
+}
+
+// Expectations returns the checks performed on the response
+func (r *request) Expectations() []Expectation {
+	return r.expectations
+}
+
+// AddExpectation adds checks performed on the response
+// Results are available through the response and the response set report.
+func (r *request) AddExpectation(e ...Expectation) Request {
+	r.expectations = append(r.expectations, e...)
+	return r
+}
+
+// SetExpectations sets the checks performed on the response
+func (r *request) SetExpectations(e []Expectation) Request {
+	r.expectations = e
+	return r
+}
+
+// Extractors returns the rules extracting variables from the response
+func (r *request) Extractors() []Extractor {
+	return r.extractors
+}
+
+// AddExtractor adds rules extracting variables from the response
+// Other requests of the request set referencing the variables with {{name}} templates in their path, headers, query
+// or body are sent once the variables have been extracted.
+func (r *request) AddExtractor(e ...Extractor) Request {
+	r.extractors = append(r.extractors, e...)
+	return r
+}
+
+// Clone returns a copy of the request whose headers and query can be updated without altering the original request
+// The body, body reader and handlers are shared
+func (r *request) Clone() Request {
+	c := *r
+	c.headers = array.CloneMap(r.headers)
+	c.query = array.CloneMap(r.query)
+	c.expectations = append([]Expectation(nil), r.expectations...)
+	c.extractors = append([]Extractor(nil), r.extractors...)
+	return &c
+}
+
 // FullPath returns the path + query parameters
 func (r *request) FullPath() string {
 	var query string
@@ -4,43 +4,402 @@
 
 package gozzle
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Duplicate name policies
+const (
+	// Adding a request whose name already exists replaces the existing request
+	DuplicateNameOverwrite string = "overwrite"
+	// Adding a request whose name already exists is ignored, ErrDuplicateName is returned by Validate and every
+	// request of the set fails with it when executed
+	DuplicateNameError string = "error"
+	// Adding a request whose name already exists adds a copy of it whose name is suffixed with -2, -3, etc. The
+	// provided request is left untouched.
+	DuplicateNameSuffix string = "suffix"
+)
+
+// Variables
+var (
+	ErrBodyConflict  = errors.New("Both body and body reader are set")
+	ErrDuplicateName = errors.New("Duplicate name")
+	ErrInvalidMethod = errors.New("Invalid method")
+	ErrInvalidName   = errors.New("Invalid name")
+	ErrInvalidURL    = errors.New("Invalid URL")
+	validURLSchemes  = map[string]bool{"http": true, "https": true}
+)
+
 // RequestSet represents a set of sendable requests
+// Names returns the order in which requests are dispatched by Exec.
 type RequestSet interface {
 	Names() []string
 	AddRequest(r Request) RequestSet
 	GetRequest(name string) Request
 	DelRequest(name string) RequestSet
+	DuplicateNamePolicy() string
+	SetDuplicateNamePolicy(p string) RequestSet
+	Validate() error
+	CookieJar() http.CookieJar
+	SetCookieJar(j http.CookieJar) RequestSet
+	Clone() RequestSet
+}
+
+// ValidationError represents an invalid request of a request set
+type ValidationError struct {
+	Err  error
+	Name string
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors represents the list of invalid requests of a request set
+type ValidationErrors []*ValidationError
+
+// Error implements the error interface
+func (es ValidationErrors) Error() string {
+	var ss []string
+	for _, e := range es {
+		ss = append(ss, e.Error())
+	}
+	return strings.Join(ss, "\n")
+}
+
+// Unwrap returns the underlying errors
+func (es ValidationErrors) Unwrap() (errs []error) {
+	for _, e := range es {
+		errs = append(errs, e)
+	}
+	return
+}
+
+// duplicateNames handles requests added with a name that already exists
+type duplicateNames struct {
+	errs   ValidationErrors
+	policy string
+}
+
+// request returns the request to add under its name or false if it must be ignored
+func (d *duplicateNames) request(r Request, exists func(name string) bool) (Request, bool) {
+	// Name is available
+	n := r.Name()
+	if !exists(n) {
+		return r, true
+	}
+
+	// Apply policy
+	switch d.policy {
+	case DuplicateNameError:
+		d.errs = append(d.errs, &ValidationError{Err: ErrDuplicateName, Name: n})
+		return nil, false
+	case DuplicateNameSuffix:
+		for i := 2; ; i++ {
+			if s := fmt.Sprintf("%s-%d", n, i); !exists(s) {
+				return r.Clone().SetName(s), true
+			}
+		}
+	default:
+		return r, true
+	}
+}
+
+// clone returns a copy of the duplicate names handler
+func (d duplicateNames) clone() duplicateNames {
+	d.errs = append(ValidationErrors(nil), d.errs...)
+	return d
+}
+
+func cloneRequests(rs map[string]Request) map[string]Request {
+	o := make(map[string]Request, len(rs))
+	for n, r := range rs {
+		o[n] = r.Clone()
+	}
+	return o
 }
 
-// NewRequestSet creates a new request set
+// validate validates the requests in the provided order
+func (d *duplicateNames) validate(names []string, get func(name string) Request) error {
+	errs := append(ValidationErrors(nil), d.errs...)
+	for _, n := range names {
+		if e := validateRequest(get(n)); e != nil {
+			errs = append(errs, &ValidationError{Err: e, Name: n})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateRequest(r Request) error {
+	// Name
+	if r.Name() == "" {
+		return ErrInvalidName
+	}
+
+	// Method
+	if r.Method() == "" || strings.IndexFunc(r.Method(), func(c rune) bool {
+		return c > '~' || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c)
+	}) > -1 {
+		return fmt.Errorf("%w %q", ErrInvalidMethod, r.Method())
+	}
+
+	// URL
+	raw := r.FullPath()
+	if socket, su, e := unixSocketURL(raw); e != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, e)
+	} else if socket != "" {
+		raw = su
+	}
+	u, e := url.Parse(raw)
+	if e != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidURL, e)
+	} else if !validURLSchemes[u.Scheme] {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	} else if u.Host == "" {
+		return fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+
+	// Body
+	if r.Body() != nil && r.BodyReader() != nil {
+		return ErrBodyConflict
+	}
+	return nil
+}
+
+// NewRequestSet creates a new request set whose names are sorted alphabetically
 func NewRequestSet() RequestSet {
-	return &requestSet{}
+	return &requestSet{
+		duplicateNames: duplicateNames{policy: DuplicateNameOverwrite},
+		requests:       make(map[string]Request),
+	}
 }
 
-type requestSet map[string]Request
+type requestSet struct {
+	duplicateNames
+	jar      http.CookieJar
+	requests map[string]Request
+}
 
-// Requests returns the list of names
+// Names returns the list of names sorted alphabetically
 func (reqSet *requestSet) Names() []string {
 	var n []string
-	for k := range *reqSet {
+	for k := range reqSet.requests {
 		n = append(n, k)
 	}
+	sort.Strings(n)
 	return n
 }
 
 // AddRequest adds a new request to the request set
 func (reqSet *requestSet) AddRequest(r Request) RequestSet {
-	(*reqSet)[r.Name()] = r
+	if r, ok := reqSet.request(r, reqSet.exists); ok {
+		reqSet.requests[r.Name()] = r
+	}
 	return reqSet
 }
 
+func (reqSet *requestSet) exists(name string) bool {
+	_, ok := reqSet.requests[name]
+	return ok
+}
+
 // GetRequest returns a request based on its name
 func (reqSet *requestSet) GetRequest(name string) Request {
-	return (*reqSet)[name]
+	return reqSet.requests[name]
 }
 
 // DelRequest removes a request from the request set
 func (reqSet *requestSet) DelRequest(name string) RequestSet {
-	delete((*reqSet), name)
+	delete(reqSet.requests, name)
+	return reqSet
+}
+
+// DuplicateNamePolicy returns what happens when a request whose name already exists is added
+func (reqSet *requestSet) DuplicateNamePolicy() string {
+	return reqSet.policy
+}
+
+// SetDuplicateNamePolicy sets what happens when a request whose name already exists is added
+// Default is DuplicateNameOverwrite.
+func (reqSet *requestSet) SetDuplicateNamePolicy(p string) RequestSet {
+	reqSet.policy = p
+	return reqSet
+}
+
+// Validate checks the names, methods, URLs and bodies of the requests before they're executed
+func (reqSet *requestSet) Validate() error {
+	return reqSet.validate(reqSet.Names(), reqSet.GetRequest)
+}
+
+// CookieJar returns the jar storing the cookies of the request set
+func (reqSet *requestSet) CookieJar() http.CookieJar {
+	return reqSet.jar
+}
+
+// SetCookieJar sets the jar storing the cookies of the request set instead of the gozzle jar
+func (reqSet *requestSet) SetCookieJar(j http.CookieJar) RequestSet {
+	reqSet.jar = j
+	return reqSet
+}
+
+// Clone returns a copy of the request set whose requests are cloned
+// The duplicate name policy, the duplicate names already ignored and the cookie jar are kept.
+func (reqSet *requestSet) Clone() RequestSet {
+	return &requestSet{
+		duplicateNames: reqSet.duplicateNames.clone(),
+		jar:            reqSet.jar,
+		requests:       cloneRequests(reqSet.requests),
+	}
+}
+
+// OrderedRequestSet represents a set of sendable requests whose names are ordered by priority, highest first, and
+// then by insertion order
+type OrderedRequestSet interface {
+	RequestSet
+	AddRequestWithPriority(r Request, priority int) OrderedRequestSet
+	Priority(name string) int
+}
+
+// NewOrderedRequestSet creates a new ordered request set
+// Adding a request whose name already exists replaces it without changing its position.
+func NewOrderedRequestSet() OrderedRequestSet {
+	return &orderedRequestSet{
+		duplicateNames: duplicateNames{policy: DuplicateNameOverwrite},
+		priorities:     make(map[string]int),
+		requests:       make(map[string]Request),
+	}
+}
+
+type orderedRequestSet struct {
+	duplicateNames
+	jar        http.CookieJar
+	names      []string
+	priorities map[string]int
+	requests   map[string]Request
+}
+
+// Names returns the list of names ordered by priority and insertion order
+func (reqSet *orderedRequestSet) Names() []string {
+	n := append([]string(nil), reqSet.names...)
+	sort.SliceStable(n, func(i, j int) bool {
+		return reqSet.priorities[n[i]] > reqSet.priorities[n[j]]
+	})
+	return n
+}
+
+// AddRequest adds a new request to the request set with a priority of 0 if it doesn't exist yet
+func (reqSet *orderedRequestSet) AddRequest(r Request) RequestSet {
+	reqSet.add(r)
+	return reqSet
+}
+
+// AddRequestWithPriority adds a new request to the request set with the provided priority
+func (reqSet *orderedRequestSet) AddRequestWithPriority(r Request, priority int) OrderedRequestSet {
+	if n, ok := reqSet.add(r); ok {
+		reqSet.priorities[n] = priority
+	}
+	return reqSet
+}
+
+func (reqSet *orderedRequestSet) add(r Request) (string, bool) {
+	r, ok := reqSet.request(r, reqSet.exists)
+	if !ok {
+		return "", false
+	}
+	n := r.Name()
+	if !reqSet.exists(n) {
+		reqSet.names = append(reqSet.names, n)
+	}
+	reqSet.requests[n] = r
+	return n, true
+}
+
+func (reqSet *orderedRequestSet) exists(name string) bool {
+	_, ok := reqSet.requests[name]
+	return ok
+}
+
+// GetRequest returns a request based on its name
+func (reqSet *orderedRequestSet) GetRequest(name string) Request {
+	return reqSet.requests[name]
+}
+
+// DelRequest removes a request from the request set
+func (reqSet *orderedRequestSet) DelRequest(name string) RequestSet {
+	if _, ok := reqSet.requests[name]; !ok {
+		return reqSet
+	}
+	delete(reqSet.requests, name)
+	delete(reqSet.priorities, name)
+	for i, n := range reqSet.names {
+		if n == name {
+			reqSet.names = append(reqSet.names[:i], reqSet.names[i+1:]...)
+			break
+		}
+	}
+	return reqSet
+}
+
+// Priority returns the priority of a request
+func (reqSet *orderedRequestSet) Priority(name string) int {
+	return reqSet.priorities[name]
+}
+
+// DuplicateNamePolicy returns what happens when a request whose name already exists is added
+func (reqSet *orderedRequestSet) DuplicateNamePolicy() string {
+	return reqSet.policy
+}
+
+// SetDuplicateNamePolicy sets what happens when a request whose name already exists is added
+// Default is DuplicateNameOverwrite.
+func (reqSet *orderedRequestSet) SetDuplicateNamePolicy(p string) RequestSet {
+	reqSet.policy = p
+	return reqSet
+}
+
+// Validate checks the names, methods, URLs and bodies of the requests before they're executed
+func (reqSet *orderedRequestSet) Validate() error {
+	return reqSet.validate(reqSet.Names(), reqSet.GetRequest)
+}
+
+// CookieJar returns the jar storing the cookies of the request set
+func (reqSet *orderedRequestSet) CookieJar() http.CookieJar {
+	return reqSet.jar
+}
+
+// SetCookieJar sets the jar storing the cookies of the request set instead of the gozzle jar
+func (reqSet *orderedRequestSet) SetCookieJar(j http.CookieJar) RequestSet {
+	reqSet.jar = j
 	return reqSet
 }
+
+// Clone returns a copy of the request set whose requests are cloned
+// The order, the priorities, the duplicate name policy, the duplicate names already ignored and the cookie jar are
+// kept.
+func (reqSet *orderedRequestSet) Clone() RequestSet {
+	c := &orderedRequestSet{
+		duplicateNames: reqSet.duplicateNames.clone(),
+		jar:            reqSet.jar,
+		names:          append([]string(nil), reqSet.names...),
+		priorities:     make(map[string]int, len(reqSet.priorities)),
+		requests:       cloneRequests(reqSet.requests),
+	}
+	for n, p := range reqSet.priorities {
+		c.priorities[n] = p
+	}
+	return c
+}
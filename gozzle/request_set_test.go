@@ -5,7 +5,12 @@
 package gozzle
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,12 +18,12 @@ import (
 
 func TestRequestSet(t *testing.T) {
 	// Initialize
-	reqSet := requestSet{
+	reqSet := requestSet{requests: map[string]Request{
 		"1": &request{},
 		"2": &request{},
 		"3": &request{},
 		"4": &request{},
-	}
+	}}
 
 	// Assert names
 	e1 := []string{"1", "2", "3", "4"}
@@ -35,3 +40,152 @@ func TestRequestSet(t *testing.T) {
 	sort.Strings(n2)
 	assert.EqualValues(t, e2, n2)
 }
+
+func TestRequestSetNamesSorted(t *testing.T) {
+	reqSet := NewRequestSet()
+	for _, n := range []string{"c", "a", "b"} {
+		reqSet.AddRequest(NewRequest(n, MethodGet, "/"))
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, reqSet.Names())
+}
+
+func TestOrderedRequestSet(t *testing.T) {
+	// Initialize
+	reqSet := NewOrderedRequestSet()
+	reqSet.AddRequest(NewRequest("c", MethodGet, "/c"))
+	reqSet.AddRequest(NewRequest("a", MethodGet, "/a"))
+	reqSet.AddRequestWithPriority(NewRequest("d", MethodGet, "/d"), 1)
+	reqSet.AddRequest(NewRequest("b", MethodGet, "/b"))
+	reqSet.AddRequestWithPriority(NewRequest("e", MethodGet, "/e"), -1)
+
+	// Assert
+	assert.Equal(t, []string{"d", "c", "a", "b", "e"}, reqSet.Names())
+	assert.Equal(t, 1, reqSet.Priority("d"))
+	assert.Equal(t, 0, reqSet.Priority("c"))
+
+	// Replace
+	reqSet.AddRequest(NewRequest("c", MethodGet, "/c2"))
+	assert.Equal(t, []string{"d", "c", "a", "b", "e"}, reqSet.Names())
+	assert.Equal(t, "/c2", reqSet.GetRequest("c").Path())
+
+	// Delete
+	reqSet.DelRequest("a").DelRequest("d").DelRequest("unknown")
+	assert.Equal(t, []string{"c", "b", "e"}, reqSet.Names())
+	assert.Nil(t, reqSet.GetRequest("a"))
+	assert.Equal(t, 0, reqSet.Priority("d"))
+}
+
+func TestRequestSetDuplicateNames(t *testing.T) {
+	for _, reqSet := range []RequestSet{NewRequestSet(), NewOrderedRequestSet()} {
+		// Overwrite
+		assert.Equal(t, DuplicateNameOverwrite, reqSet.DuplicateNamePolicy())
+		reqSet.AddRequest(NewRequest("a", MethodGet, "http://localhost/1"))
+		reqSet.AddRequest(NewRequest("a", MethodGet, "http://localhost/2"))
+		assert.Equal(t, []string{"a"}, reqSet.Names())
+		assert.Equal(t, "http://localhost/2", reqSet.GetRequest("a").Path())
+		assert.NoError(t, reqSet.Validate())
+
+		// Suffix
+		reqSet.SetDuplicateNamePolicy(DuplicateNameSuffix)
+		r := NewRequest("a", MethodGet, "http://localhost/3")
+		reqSet.AddRequest(r)
+		reqSet.AddRequest(NewRequest("a", MethodGet, "http://localhost/4"))
+		assert.Equal(t, []string{"a", "a-2", "a-3"}, reqSet.Names())
+		assert.Equal(t, "a", r.Name())
+		assert.Equal(t, "http://localhost/3", reqSet.GetRequest("a-2").Path())
+		assert.NoError(t, reqSet.Validate())
+
+		// Error
+		reqSet.SetDuplicateNamePolicy(DuplicateNameError)
+		reqSet.AddRequest(NewRequest("a", MethodGet, "http://localhost/5"))
+		assert.Equal(t, []string{"a", "a-2", "a-3"}, reqSet.Names())
+		assert.Equal(t, "http://localhost/2", reqSet.GetRequest("a").Path())
+		e := reqSet.Validate()
+		assert.True(t, errors.Is(e, ErrDuplicateName))
+		assert.EqualError(t, e, "a: Duplicate name")
+	}
+}
+
+func TestRequestSetClone(t *testing.T) {
+	// Ordered
+	r := NewRequest("a", MethodGet, "http://localhost/1")
+	o := NewOrderedRequestSet()
+	o.SetDuplicateNamePolicy(DuplicateNameError)
+	o.AddRequest(r).AddRequest(NewRequest("a", MethodGet, "http://localhost/2"))
+	o.AddRequestWithPriority(NewRequest("b", MethodGet, "http://localhost/3"), 1)
+	c := o.Clone()
+	_, ok := c.(OrderedRequestSet)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"b", "a"}, c.Names())
+	assert.Equal(t, DuplicateNameError, c.DuplicateNamePolicy())
+	assert.True(t, errors.Is(c.Validate(), ErrDuplicateName))
+	assert.NotSame(t, r, c.GetRequest("a"))
+	assert.Equal(t, "http://localhost/1", c.GetRequest("a").Path())
+	c.AddRequest(NewRequest("c", MethodGet, "http://localhost/4"))
+	assert.Equal(t, []string{"b", "a"}, o.Names())
+
+	// Unordered
+	s := NewRequestSet().SetDuplicateNamePolicy(DuplicateNameSuffix).AddRequest(r)
+	c = s.Clone()
+	assert.Equal(t, DuplicateNameSuffix, c.DuplicateNamePolicy())
+	c.AddRequest(r)
+	assert.Equal(t, []string{"a", "a-2"}, c.Names())
+	assert.Equal(t, []string{"a"}, s.Names())
+}
+
+func TestExecDuplicateNameError(t *testing.T) {
+	// Initialize
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	defer s.Close()
+	reqSet := NewRequestSet().
+		SetDuplicateNamePolicy(DuplicateNameError).
+		AddRequest(NewRequest("a", MethodGet, s.URL)).
+		AddRequest(NewRequest("a", MethodGet, s.URL)).
+		AddRequest(NewRequest("b", MethodGet, s.URL))
+
+	// Execute
+	respSet := NewGozzle().Exec(reqSet)
+
+	// Assert
+	for _, n := range []string{"a", "b"} {
+		errs := respSet.GetResponse(n).Errors()
+		assert.Len(t, errs, 1)
+		assert.True(t, errors.Is(errs[0], ErrDuplicateName))
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+}
+
+func TestRequestSetValidate(t *testing.T) {
+	// Initialize
+	reqSet := NewOrderedRequestSet()
+	reqSet.AddRequest(NewRequest("valid", MethodPost, "https://localhost:8080/path").SetBody([]byte("test")))
+	reqSet.AddRequest(NewRequest("custom-method", "PURGE", "http://localhost"))
+	reqSet.AddRequest(NewRequest("", MethodGet, "http://localhost"))
+	reqSet.AddRequest(NewRequest("method", "GET /", "http://localhost"))
+	reqSet.AddRequest(NewRequest("empty-method", "", "http://localhost"))
+	reqSet.AddRequest(NewRequest("relative", MethodGet, "/path"))
+	reqSet.AddRequest(NewRequest("scheme", MethodGet, "ftp://localhost"))
+	reqSet.AddRequest(NewRequest("parse", MethodGet, "http://local host"))
+	reqSet.AddRequest(NewRequest("body", MethodPost, "http://localhost").SetBody("test").SetBodyReader(strings.NewReader("test")))
+
+	// Validate
+	e := reqSet.Validate()
+
+	// Assert
+	assert.IsType(t, ValidationErrors{}, e)
+	assert.EqualError(t, e, `: Invalid name
+method: Invalid method "GET /"
+empty-method: Invalid method ""
+relative: Invalid URL: unsupported scheme ""
+scheme: Invalid URL: unsupported scheme "ftp"
+parse: Invalid URL: parse "http://local host": invalid character " " in host name
+body: Both body and body reader are set`)
+	assert.True(t, errors.Is(e, ErrInvalidMethod))
+	assert.True(t, errors.Is(e, ErrInvalidURL))
+	assert.True(t, errors.Is(e, ErrBodyConflict))
+	assert.Len(t, e.(ValidationErrors), 7)
+	assert.Equal(t, "body", e.(ValidationErrors)[6].Name)
+}
@@ -40,3 +40,19 @@ func TestQueryEncoding(t *testing.T) {
 	assert.Equal(t, "?a=b&k%C3%A9%40l%C3%B9=%C3%B9l%40%C3%A9k", r1.FullPath())
 	assert.Empty(t, r2.FullPath())
 }
+
+func TestClone(t *testing.T) {
+	// Initialize
+	r1 := NewRequest("test", MethodGet, "/").AddHeader("k", "v").AddQuery("k", "v")
+
+	// Clone
+	r2 := r1.Clone().SetName("clone").AddHeader("k", "v2").AddQuery("k2", "v2")
+
+	// Assert
+	assert.Equal(t, "test", r1.Name())
+	assert.Equal(t, "v", r1.GetHeader("k"))
+	assert.Equal(t, map[string]string{"k": "v"}, r1.Query())
+	assert.Equal(t, "clone", r2.Name())
+	assert.Equal(t, "v2", r2.GetHeader("k"))
+	assert.Equal(t, "/?k=v&k2=v2", r2.FullPath())
+}
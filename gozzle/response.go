@@ -6,15 +6,23 @@ package gozzle
 
 import (
 	"bytes"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	statusErrorBodySize = 512
 )
 
 // Variables
 var (
-	ErrInvalidStatusCode   = errors.New("Invalid status code")
 	ErrNilOriginalResponse = errors.New("Nil original response")
 )
 
@@ -27,12 +35,35 @@ type Response interface {
 	BodyReader() io.ReadCloser
 	Body() ([]byte, error)
 	Close() error
+	Timing() Timing
+	Events() EventStream
+	Records() RecordStream
+	Expectations() []ExpectationResult
+	State() string
+	SkipReason() string
+	Cookies() []*http.Cookie
+	Redirects() []Redirect
+	TLSVersion() string
+	PeerCertificates() []*x509.Certificate
+}
+
+// Timing represents the timing of a request
+// QueueWait is the time spent waiting for the rate limiter before sending the request, Start is the time the request
+// was sent at and Duration is the time spent until the response headers were received.
+type Timing struct {
+	QueueWait time.Duration
+	Start     time.Time
+	Duration  time.Duration
 }
 
 // NewResponseError creates a new response with an error set by default
 func NewResponseError(e error) Response {
+	return newResponseError(e, Timing{})
+}
+
+func newResponseError(e error, t Timing) *response {
 	// Create response
-	r := response{}
+	r := response{timing: t}
 
 	// Add error
 	r.errors = append(r.errors, e)
@@ -42,38 +73,120 @@ func NewResponseError(e error) Response {
 }
 
 // NewResponse creates a new response based on an *http.Response
+// Responses whose status code is not 2xx get a *StatusError, bodies are decompressed based on their Content-Encoding
+// header and truncated after maxSizeBody bytes if > 0
 func NewResponse(or *http.Response, maxSizeBody int) Response {
+	return newResponse(or, responseOptions{
+		bodyLimitMode: BodyLimitTruncate,
+		decompress:    true,
+		maxSizeBody:   maxSizeBody,
+		successPolicy: DefaultSuccessPolicy,
+	})
+}
+
+type responseOptions struct {
+	bodyLimitMode string
+	decompress    bool
+	maxSizeBody   int
+	successPolicy SuccessPolicy
+}
+
+func newResponse(or *http.Response, o responseOptions) *response {
 	// Initialize
 	r := response{
 		originalResponse: or,
 	}
 
-	// Check status code
-	if r.StatusCode() < 200 || r.StatusCode() >= 300 {
-		r.errors = append(r.errors, ErrInvalidStatusCode)
+	// Decompress body
+	if o.decompress {
+		r.decompressBody()
 	}
 
 	// Update body reader
-	if maxSizeBody > 0 {
-		r.originalResponse.Body = ioutil.NopCloser(
-			io.LimitReader(r.originalResponse.Body, int64(maxSizeBody)),
-		)
+	// The max size applies to the decompressed body to guard against decompression bombs
+	if o.maxSizeBody > 0 {
+		r.limitBody(int64(o.maxSizeBody), o.bodyLimitMode)
+	}
+
+	// Check success
+	if !o.successPolicy(&r) {
+		r.addError(newStatusError(r.originalResponse))
 	}
 
 	// Return
 	return &r
 }
 
+// StatusError represents the error of a response whose status code is not considered successful
+// Body contains the first bytes of the response body
+type StatusError struct {
+	Body       []byte
+	Status     string
+	StatusCode int
+}
+
+func newStatusError(or *http.Response) *StatusError {
+	// Initialize
+	e := &StatusError{
+		Status:     or.Status,
+		StatusCode: or.StatusCode,
+	}
+
+	// Read the beginning of the body without consuming it unless the body is a stream
+	if or.Body != nil && !isStreaming(or) {
+		e.Body, _ = ioutil.ReadAll(io.LimitReader(or.Body, statusErrorBodySize))
+		or.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(e.Body), or.Body), or.Body}
+	}
+	return e
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("Invalid status code %s", e.Status)
+	}
+	return fmt.Sprintf("Invalid status code %d", e.StatusCode)
+}
+
 type response struct {
 	errors           []error
+	expectations     []ExpectationResult
+	mutex            sync.Mutex
 	originalResponse *http.Response
+	reconnect        func(lastEventID string) (io.ReadCloser, error)
+	redirects        []Redirect
+	skipReason       string
+	skipped          bool
+	timing           Timing
 }
 
 // Error returns the response error
 func (r *response) Errors() []error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	return r.errors
 }
 
+func (r *response) addError(e error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.errors = append(r.errors, e)
+}
+
+func (r *response) addErrorOnce(e error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, v := range r.errors {
+		if v == e {
+			return
+		}
+	}
+	r.errors = append(r.errors, e)
+}
+
 // Status returns the response status text
 func (r *response) Status() string {
 	if r.originalResponse == nil {
@@ -116,7 +229,10 @@ func (r *response) Body() ([]byte, error) {
 	if err != nil {
 		return b, err
 	}
-	r.originalResponse.Body = ioutil.NopCloser(bytes.NewReader(c))
+	r.originalResponse.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(c), r.originalResponse.Body}
 	return c, nil
 }
 
@@ -127,3 +243,13 @@ func (r *response) Close() error {
 	}
 	return r.originalResponse.Body.Close()
 }
+
+// Timing returns the timing of the request
+func (r *response) Timing() Timing {
+	return r.timing
+}
+
+// Expectations returns the results of the request expectations
+func (r *response) Expectations() []ExpectationResult {
+	return r.expectations
+}
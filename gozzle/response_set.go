@@ -4,53 +4,133 @@
 
 package gozzle
 
-import "sync"
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
 
 // ResponseSet represents a set of responses
+// Names returns the names in the order of the executed request set, or in insertion order for responses added
+// manually, whereas SortedNames returns them sorted alphabetically. Response sets are safe for concurrent use.
 type ResponseSet interface {
 	Names() []string
+	SortedNames() []string
 	AddResponse(req Request, resp Response) ResponseSet
 	GetResponse(name string) Response
 	DelResponse(name string) ResponseSet
 	Close() map[string]error
+	Report() ExpectationReport
+	Variables() map[string]string
+	Range(f func(name string, resp Response) bool)
+	Successes() ResponseSet
+	Failures() ResponseSet
+	Skipped() ResponseSet
+	Summary() ResponseSetSummary
+}
+
+// ResponseSetSummary represents the counts of the responses of a response set
+// Statuses counts responses by status class such as "2xx". Responses without status code, such as the ones of
+// requests that failed to be sent, are counted under "none" whereas skipped requests are only counted in Skipped.
+type ResponseSetSummary struct {
+	Failures  int
+	Skipped   int
+	Statuses  map[string]int
+	Successes int
+	Total     int
 }
 
 // NewResponseSet creates a new response set
 func NewResponseSet() ResponseSet {
+	return newResponseSet()
+}
+
+func newResponseSet(names ...string) *responseSet {
 	return &responseSet{
+		names:     names,
 		responses: make(map[string]Response),
+		variables: make(map[string]string),
 	}
 }
 
 type responseSet struct {
+	names     []string
 	responses map[string]Response
-	mutex     sync.Mutex
+	mutex     sync.RWMutex
+	variables map[string]string
 }
 
-// Responses returns the list of names
+// Names returns the list of names in order
 func (respSet *responseSet) Names() []string {
+	respSet.mutex.RLock()
+	defer respSet.mutex.RUnlock()
+	return respSet.orderedNames()
+}
+
+func (respSet *responseSet) orderedNames() []string {
+	// Ordered names
 	var n []string
+	m := make(map[string]bool)
+	for _, k := range respSet.names {
+		if _, ok := respSet.responses[k]; ok && !m[k] {
+			n = append(n, k)
+			m[k] = true
+		}
+	}
+
+	// Unordered names
+	var u []string
 	for k := range respSet.responses {
-		n = append(n, k)
+		if !m[k] {
+			u = append(u, k)
+		}
 	}
+	sort.Strings(u)
+	return append(n, u...)
+}
+
+// SortedNames returns the list of names sorted alphabetically
+func (respSet *responseSet) SortedNames() []string {
+	n := respSet.Names()
+	sort.Strings(n)
 	return n
 }
 
 // AddResponse adds a new response to the response set
 func (respSet *responseSet) AddResponse(req Request, resp Response) ResponseSet {
-	respSet.mutex.Lock()
-	respSet.responses[req.Name()] = resp
-	respSet.mutex.Unlock()
+	respSet.add(req.Name(), resp)
 	return respSet
 }
 
+func (respSet *responseSet) add(name string, resp Response) {
+	respSet.mutex.Lock()
+	defer respSet.mutex.Unlock()
+	if _, ok := respSet.responses[name]; !ok && !respSet.hasName(name) {
+		respSet.names = append(respSet.names, name)
+	}
+	respSet.responses[name] = resp
+}
+
+func (respSet *responseSet) hasName(name string) bool {
+	for _, n := range respSet.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetResponse returns a request based on its name
 func (respSet *responseSet) GetResponse(name string) Response {
+	respSet.mutex.RLock()
+	defer respSet.mutex.RUnlock()
 	return respSet.responses[name]
 }
 
 // DelResponse removes a request from the request set
 func (respSet *responseSet) DelResponse(name string) ResponseSet {
+	respSet.mutex.Lock()
+	defer respSet.mutex.Unlock()
 	delete(respSet.responses, name)
 	return respSet
 }
@@ -58,8 +138,111 @@ func (respSet *responseSet) DelResponse(name string) ResponseSet {
 // Close closes the responses in the response set
 func (respSet *responseSet) Close() map[string]error {
 	errors := make(map[string]error)
-	for k, v := range respSet.responses {
-		errors[k] = v.Close()
-	}
+	respSet.Range(func(name string, resp Response) bool {
+		errors[name] = resp.Close()
+		return true
+	})
 	return errors
 }
+
+// Report returns the results of the expectations of all responses in order
+func (respSet *responseSet) Report() (r ExpectationReport) {
+	respSet.Range(func(name string, resp Response) bool {
+		r = append(r, resp.Expectations()...)
+		return true
+	})
+	return
+}
+
+// Variables returns the variables extracted while executing the requests
+func (respSet *responseSet) Variables() map[string]string {
+	respSet.mutex.RLock()
+	defer respSet.mutex.RUnlock()
+	return respSet.variables
+}
+
+func (respSet *responseSet) setVariables(vs map[string]string) {
+	respSet.mutex.Lock()
+	defer respSet.mutex.Unlock()
+	respSet.variables = vs
+}
+
+// Range calls f for each response in order until f returns false
+// The set is not locked while f is called so that f can use the set.
+func (respSet *responseSet) Range(f func(name string, resp Response) bool) {
+	// Snapshot responses
+	respSet.mutex.RLock()
+	names := respSet.orderedNames()
+	resps := make([]Response, 0, len(names))
+	for _, name := range names {
+		resps = append(resps, respSet.responses[name])
+	}
+	respSet.mutex.RUnlock()
+
+	// Loop through responses
+	for i, name := range names {
+		if !f(name, resps[i]) {
+			return
+		}
+	}
+}
+
+// Successes returns a new response set containing the responses of sent requests without errors
+// Responses are shared with the original set.
+func (respSet *responseSet) Successes() ResponseSet {
+	return respSet.filter(func(resp Response) bool {
+		return resp.State() != ResponseStateSkipped && len(resp.Errors()) == 0
+	})
+}
+
+// Failures returns a new response set containing the responses with errors
+// Responses are shared with the original set.
+func (respSet *responseSet) Failures() ResponseSet {
+	return respSet.filter(func(resp Response) bool { return len(resp.Errors()) > 0 })
+}
+
+// Skipped returns a new response set containing the responses of skipped requests
+func (respSet *responseSet) Skipped() ResponseSet {
+	return respSet.filter(func(resp Response) bool { return resp.State() == ResponseStateSkipped })
+}
+
+func (respSet *responseSet) filter(f func(resp Response) bool) ResponseSet {
+	r := newResponseSet()
+	r.variables = respSet.Variables()
+	respSet.Range(func(name string, resp Response) bool {
+		if f(resp) {
+			r.add(name, resp)
+		}
+		return true
+	})
+	return r
+}
+
+// Summary returns the counts of the responses
+func (respSet *responseSet) Summary() (s ResponseSetSummary) {
+	s.Statuses = make(map[string]int)
+	respSet.Range(func(name string, resp Response) bool {
+		// Skipped
+		s.Total++
+		if resp.State() == ResponseStateSkipped {
+			s.Skipped++
+			return true
+		}
+
+		// Success
+		if len(resp.Errors()) == 0 {
+			s.Successes++
+		} else {
+			s.Failures++
+		}
+
+		// Status class
+		if c := resp.StatusCode(); c > 0 {
+			s.Statuses[fmt.Sprintf("%dxx", c/100)]++
+		} else {
+			s.Statuses["none"]++
+		}
+		return true
+	})
+	return
+}
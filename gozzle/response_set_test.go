@@ -5,7 +5,11 @@
 package gozzle
 
 import (
+	"errors"
+	"net/http"
 	"sort"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,3 +41,75 @@ func TestResponseSet(t *testing.T) {
 	sort.Strings(n2)
 	assert.EqualValues(t, e2, n2)
 }
+
+func TestResponseSetOrder(t *testing.T) {
+	// Manual
+	respSet := NewResponseSet()
+	for _, n := range []string{"c", "a", "b"} {
+		respSet.AddResponse(NewRequest(n, MethodGet, "/"), &response{})
+	}
+	respSet.AddResponse(NewRequest("c", MethodGet, "/"), &response{})
+	assert.Equal(t, []string{"c", "a", "b"}, respSet.Names())
+	assert.Equal(t, []string{"a", "b", "c"}, respSet.SortedNames())
+
+	// Request order
+	respSet = newResponseSet("b", "c", "a")
+	for _, n := range []string{"a", "d", "b"} {
+		respSet.AddResponse(NewRequest(n, MethodGet, "/"), &response{})
+	}
+	assert.Equal(t, []string{"b", "a", "d"}, respSet.Names())
+}
+
+func TestResponseSetViews(t *testing.T) {
+	// Initialize
+	respSet := NewResponseSet()
+	for n, r := range map[string]*response{
+		"ok":       {originalResponse: &http.Response{StatusCode: http.StatusOK}},
+		"created":  {originalResponse: &http.Response{StatusCode: http.StatusCreated}},
+		"missing":  {errors: []error{errors.New("test")}, originalResponse: &http.Response{StatusCode: http.StatusNotFound}},
+		"internal": {errors: []error{errors.New("test")}, originalResponse: &http.Response{StatusCode: http.StatusInternalServerError}},
+		"error":    {errors: []error{errors.New("test")}},
+	} {
+		respSet.AddResponse(NewRequest(n, MethodGet, "/"), r)
+	}
+
+	// Range
+	var names []string
+	respSet.Range(func(name string, resp Response) bool {
+		names = append(names, name)
+		return len(names) < 2
+	})
+	assert.Len(t, names, 2)
+
+	// Views
+	assert.Equal(t, []string{"created", "ok"}, respSet.Successes().SortedNames())
+	assert.Equal(t, []string{"error", "internal", "missing"}, respSet.Failures().SortedNames())
+
+	// Summary
+	assert.Equal(t, ResponseSetSummary{
+		Failures:  3,
+		Statuses:  map[string]int{"2xx": 2, "4xx": 1, "5xx": 1, "none": 1},
+		Successes: 2,
+		Total:     5,
+	}, respSet.Summary())
+}
+
+func TestResponseSetConcurrency(t *testing.T) {
+	respSet := NewResponseSet()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			respSet.AddResponse(NewRequest(strconv.Itoa(i), MethodGet, "/"), &response{})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			respSet.GetResponse(strconv.Itoa(i))
+			respSet.Names()
+			respSet.Summary()
+			respSet.DelResponse(strconv.Itoa(i - 1))
+		}(i)
+	}
+	wg.Wait()
+}
@@ -31,7 +31,26 @@ func TestNewResponseInvalidStatusCode(t *testing.T) {
 	// Assert
 	assert.Len(t, httpRespSuccess.Errors(), 0)
 	assert.Len(t, httpRespError.Errors(), 1)
-	assert.EqualError(t, httpRespError.Errors()[0], ErrInvalidStatusCode.Error())
+	assert.IsType(t, &StatusError{}, httpRespError.Errors()[0])
+	assert.Equal(t, 400, httpRespError.Errors()[0].(*StatusError).StatusCode)
+}
+
+func TestNewResponseStatusError(t *testing.T) {
+	// Initialize
+	b := bytes.Repeat([]byte("a"), statusErrorBodySize+1)
+	resp := NewResponse(&http.Response{Status: "404 Not Found", StatusCode: 404, Body: mockedIoReaderCloser(b)}, 0)
+
+	// Assert
+	assert.Len(t, resp.Errors(), 1)
+	e := resp.Errors()[0].(*StatusError)
+	assert.EqualError(t, e, "Invalid status code 404 Not Found")
+	assert.Equal(t, "404 Not Found", e.Status)
+	assert.Equal(t, b[:statusErrorBodySize], e.Body)
+
+	// Check body reader is intact
+	b1, err := ioutil.ReadAll(resp.BodyReader())
+	assert.NoError(t, err)
+	assert.Equal(t, b, b1)
 }
 
 type mockedCloser struct{}
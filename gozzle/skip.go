@@ -0,0 +1,79 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import "errors"
+
+// Response states
+const (
+	// The request has been sent and a response has been received, whatever its status code
+	ResponseStateSent string = "sent"
+	// The request has not been sent because of its before handler
+	ResponseStateSkipped string = "skipped"
+	// The request could not be sent or no response has been received
+	ResponseStateFailed string = "failed"
+)
+
+// Constants
+const (
+	beforeHandlerSkipReason = "Before handler returned false"
+)
+
+// SkipError represents the error returned by a before handler to skip its request
+type SkipError struct {
+	Reason string
+}
+
+// Skip creates an error which, once returned by a before handler, skips the request for the provided reason
+func Skip(reason string) error {
+	return &SkipError{Reason: reason}
+}
+
+// Error implements the error interface
+func (e *SkipError) Error() string {
+	return "Skipped: " + e.Reason
+}
+
+func newSkippedResponse(reason string) *response {
+	return &response{
+		skipReason: reason,
+		skipped:    true,
+	}
+}
+
+// runBeforeHandlers returns the response of the request if it must not be sent
+func runBeforeHandlers(req Request) *response {
+	// Before handler
+	if h := req.BeforeHandler(); h != nil && !h(req) {
+		return newSkippedResponse(beforeHandlerSkipReason)
+	}
+
+	// Before handler returning an error
+	if h := req.BeforeHandlerE(); h != nil {
+		if e := h(req); e != nil {
+			var s *SkipError
+			if errors.As(e, &s) {
+				return newSkippedResponse(s.Reason)
+			}
+			return newResponseError(e, Timing{})
+		}
+	}
+	return nil
+}
+
+// State returns whether the request has been sent, skipped or has failed
+func (r *response) State() string {
+	if r.skipped {
+		return ResponseStateSkipped
+	} else if r.originalResponse != nil {
+		return ResponseStateSent
+	}
+	return ResponseStateFailed
+}
+
+// SkipReason returns why the request has been skipped
+func (r *response) SkipReason() string {
+	return r.skipReason
+}
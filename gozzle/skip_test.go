@@ -0,0 +1,73 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecBeforeHandlerE(t *testing.T) {
+	// Initialize
+	var count int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	defer s.Close()
+	var afterHandlerCalled bool
+	reqSet := NewOrderedRequestSet()
+	reqSet.AddRequest(NewRequest("sent", MethodGet, s.URL).SetBeforeHandlerE(func(r Request) error { return nil }))
+	reqSet.AddRequest(NewRequest("skipped", MethodGet, s.URL).SetBeforeHandlerE(func(r Request) error {
+		return fmt.Errorf("wrapped: %w", Skip("feature disabled"))
+	}).SetAfterHandler(func(req Request, resp Response) { afterHandlerCalled = true }))
+	reqSet.AddRequest(NewRequest("failed", MethodGet, s.URL).SetBeforeHandlerE(func(r Request) error {
+		return errors.New("missing token")
+	}))
+	reqSet.AddRequest(NewRequest("transport", MethodGet, "http://127.0.0.1:0"))
+	reqSet.AddRequest(NewRequest("bool", MethodGet, s.URL).SetBeforeHandler(func(r Request) bool {
+		return false
+	}).SetBeforeHandlerE(func(r Request) error {
+		t.Error("before handler E should not be called")
+		return nil
+	}))
+
+	// Execute
+	respSet := NewGozzle().Exec(reqSet)
+
+	// Assert
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	assert.False(t, afterHandlerCalled)
+	assert.Equal(t, []string{"sent", "skipped", "failed", "transport", "bool"}, respSet.Names())
+	for n, st := range map[string]string{
+		"sent":      ResponseStateSent,
+		"skipped":   ResponseStateSkipped,
+		"failed":    ResponseStateFailed,
+		"transport": ResponseStateFailed,
+		"bool":      ResponseStateSkipped,
+	} {
+		assert.Equal(t, st, respSet.GetResponse(n).State(), n)
+	}
+	assert.Equal(t, "feature disabled", respSet.GetResponse("skipped").SkipReason())
+	assert.Empty(t, respSet.GetResponse("skipped").Errors())
+	assert.EqualError(t, respSet.GetResponse("failed").Errors()[0], "missing token")
+	assert.Equal(t, "", respSet.GetResponse("failed").SkipReason())
+	assert.Equal(t, []string{"skipped", "bool"}, respSet.Skipped().Names())
+	assert.Equal(t, []string{"sent"}, respSet.Successes().Names())
+	assert.Equal(t, []string{"failed", "transport"}, respSet.Failures().Names())
+	assert.Equal(t, ResponseSetSummary{
+		Failures:  2,
+		Skipped:   2,
+		Statuses:  map[string]int{"2xx": 1, "none": 2},
+		Successes: 1,
+		Total:     5,
+	}, respSet.Summary())
+	assert.EqualError(t, Skip("test"), "Skipped: test")
+}
@@ -0,0 +1,312 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	defaultEventRetry = 3 * time.Second
+	recordSeparator   = 0x1e
+)
+
+// Event represents a server-sent event
+type Event struct {
+	Data  string
+	Event string
+	ID    string
+	Retry time.Duration
+}
+
+// EventStream represents an iterator over the server-sent events of a response
+type EventStream interface {
+	// Next returns the next event or io.EOF once the stream is over
+	Next() (Event, error)
+	// LastEventID returns the id of the last event received
+	LastEventID() string
+	// SetReconnect sets the max number of times the request is sent again with a Last-Event-ID header when the
+	// stream ends or fails
+	SetReconnect(max int) EventStream
+	// Close closes the stream and interrupts any pending reconnection
+	Close() error
+}
+
+// RecordStream represents an iterator over the records of an NDJSON or JSON sequence response
+type RecordStream interface {
+	// Next decodes the next record into v or returns io.EOF once the stream is over
+	Next(v interface{}) error
+	Close() error
+}
+
+// isStreaming checks whether the response content type is a streaming one
+func isStreaming(or *http.Response) bool {
+	if or.Header == nil {
+		return false
+	}
+	t, _, _ := mime.ParseMediaType(or.Header.Get("Content-Type"))
+	switch t {
+	case "text/event-stream", "application/x-ndjson", "application/ndjson", "application/jsonl",
+		"application/json-seq":
+		return true
+	}
+	return false
+}
+
+// Events returns an iterator over the server-sent events of the response
+func (r *response) Events() EventStream {
+	s := &eventStream{
+		body:      r.BodyReader(),
+		ctx:       context.Background(),
+		done:      make(chan struct{}),
+		reader:    bufio.NewReader(r.BodyReader()),
+		reconnect: r.reconnect,
+		retry:     defaultEventRetry,
+	}
+	if r.originalResponse != nil && r.originalResponse.Request != nil {
+		s.ctx = r.originalResponse.Request.Context()
+	}
+	return s
+}
+
+// Records returns an iterator over the records of an NDJSON or JSON sequence response
+// Records of "application/json-seq" responses are split on the record separator as described in RFC 7464 and can
+// therefore span several lines whereas records of other responses are split on new lines.
+func (r *response) Records() RecordStream {
+	s := &recordStream{
+		body:      r.BodyReader(),
+		delimiter: '\n',
+		reader:    bufio.NewReader(r.BodyReader()),
+	}
+	if r.originalResponse != nil {
+		if t, _, _ := mime.ParseMediaType(r.originalResponse.Header.Get("Content-Type")); t == "application/json-seq" {
+			s.delimiter = recordSeparator
+		}
+	}
+	return s
+}
+
+type eventStream struct {
+	body          io.ReadCloser
+	closed        bool
+	ctx           context.Context
+	done          chan struct{}
+	lastEventID   string
+	maxReconnects int
+	mutex         sync.Mutex
+	reader        *bufio.Reader
+	reconnect     func(lastEventID string) (io.ReadCloser, error)
+	reconnects    int
+	retry         time.Duration
+}
+
+// SetReconnect implements the EventStream interface
+func (s *eventStream) SetReconnect(max int) EventStream {
+	s.maxReconnects = max
+	return s
+}
+
+// LastEventID implements the EventStream interface
+func (s *eventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Close implements the EventStream interface
+func (s *eventStream) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return s.body.Close()
+}
+
+// Next implements the EventStream interface
+func (s *eventStream) Next() (ev Event, e error) {
+	for {
+		// Read event
+		if ev, e = s.read(); e == nil {
+			return
+		}
+
+		// Reconnect
+		if !s.canReconnect() {
+			return
+		}
+		if e = s.wait(); e != nil {
+			return
+		}
+		var body io.ReadCloser
+		if body, e = s.reconnect(s.lastEventID); e != nil {
+			return
+		}
+
+		// Update body
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			body.Close()
+			return ev, io.EOF
+		}
+		s.body.Close()
+		s.body = body
+		s.reader = bufio.NewReader(body)
+		s.mutex.Unlock()
+	}
+}
+
+// wait waits for the retry delay unless the stream is closed or the request context is done in the meantime
+func (s *eventStream) wait() error {
+	t := time.NewTimer(s.retry)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-s.done:
+		return io.EOF
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *eventStream) canReconnect() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed || s.reconnect == nil || s.reconnects >= s.maxReconnects {
+		return false
+	}
+	s.reconnects++
+	return true
+}
+
+// read parses the next event as described in https://html.spec.whatwg.org/multipage/server-sent-events.html
+func (s *eventStream) read() (ev Event, e error) {
+	var data []string
+	var hasData bool
+	for {
+		// Read line
+		var l string
+		if l, e = s.reader.ReadString('\n'); e != nil && (e != io.EOF || l == "") {
+			return Event{}, e
+		}
+		l = strings.TrimRight(l, "\r\n")
+
+		// Dispatch event
+		if l == "" {
+			if !hasData {
+				ev = Event{}
+				continue
+			}
+			ev.Data = strings.Join(data, "\n")
+			ev.ID = s.lastEventID
+			if ev.Event == "" {
+				ev.Event = "message"
+			}
+			return ev, nil
+		}
+
+		// Comment
+		if strings.HasPrefix(l, ":") {
+			continue
+		}
+
+		// Parse field
+		k, v := l, ""
+		if i := strings.Index(l, ":"); i > -1 {
+			k, v = l[:i], strings.TrimPrefix(l[i+1:], " ")
+		}
+		switch k {
+		case "data":
+			data = append(data, v)
+			hasData = true
+		case "event":
+			ev.Event = v
+		case "id":
+			if !strings.Contains(v, "\x00") {
+				s.lastEventID = v
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(v); err == nil && ms >= 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+				ev.Retry = s.retry
+			}
+		}
+	}
+}
+
+type recordStream struct {
+	body      io.ReadCloser
+	delimiter byte
+	reader    *bufio.Reader
+}
+
+// Next implements the RecordStream interface
+func (s *recordStream) Next(v interface{}) error {
+	for {
+		// Read record
+		l, e := s.reader.ReadBytes(s.delimiter)
+		if e != nil && (e != io.EOF || len(l) == 0) {
+			return e
+		}
+
+		// Skip empty records
+		l = bytes.TrimSpace(bytes.Trim(l, string(rune(recordSeparator))))
+		if len(l) == 0 {
+			continue
+		}
+		return json.Unmarshal(l, v)
+	}
+}
+
+// Close implements the RecordStream interface
+func (s *recordStream) Close() error {
+	return s.body.Close()
+}
+
+// reconnectFunc returns a function sending the request again with a Last-Event-ID header
+func (g gozzle) reconnectFunc(req Request) func(lastEventID string) (io.ReadCloser, error) {
+	return func(lastEventID string) (io.ReadCloser, error) {
+		// Create http request
+		httpReq, e := g.newHTTPRequest(req)
+		if e != nil {
+			return nil, e
+		}
+		if lastEventID != "" {
+			httpReq.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		// Wait for the rate limiter
+		if _, e = g.rateLimiter.wait(httpReq); e != nil {
+			closeRequestBody(httpReq)
+			return nil, e
+		}
+
+		// Send request
+		httpResp, e := g.roundTrip()(req, httpReq)
+		if e != nil {
+			return nil, e
+		}
+
+		// Create response
+		resp := newResponse(httpResp, g.responseOptions(req))
+		if errs := resp.Errors(); len(errs) > 0 {
+			resp.Close()
+			return nil, errs[0]
+		}
+		return resp.BodyReader(), nil
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventStream(t *testing.T) {
+	// Initialize
+	r := &response{originalResponse: &http.Response{Body: mockedIoReaderCloser([]byte(": comment\n\n" +
+		"data: first\r\n\r\n" +
+		"event: test\nid: 1\nretry: 10\ndata: second\ndata:third\n\n" +
+		"data: incomplete"))}}
+	s := r.Events()
+
+	// Assert
+	ev, e := s.Next()
+	assert.NoError(t, e)
+	assert.Equal(t, Event{Data: "first", Event: "message"}, ev)
+	ev, e = s.Next()
+	assert.NoError(t, e)
+	assert.Equal(t, Event{Data: "second\nthird", Event: "test", ID: "1", Retry: 10 * time.Millisecond}, ev)
+	assert.Equal(t, "1", s.LastEventID())
+	_, e = s.Next()
+	assert.Equal(t, io.EOF, e)
+}
+
+func TestEventStreamBackOff(t *testing.T) {
+	// Initialize
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reconnects int
+	newStream := func() *eventStream {
+		r := &response{
+			originalResponse: &http.Response{
+				Body:    mockedIoReaderCloser([]byte{}),
+				Request: (&http.Request{}).WithContext(ctx),
+			},
+			reconnect: func(lastEventID string) (io.ReadCloser, error) {
+				reconnects++
+				return nil, errors.New("reconnect")
+			},
+		}
+		s := r.Events().SetReconnect(1).(*eventStream)
+		s.retry = time.Minute
+		return s
+	}
+
+	// Close interrupts the back off
+	s := newStream()
+	time.AfterFunc(20*time.Millisecond, func() { s.Close() })
+	n := time.Now()
+	_, e := s.Next()
+	assert.Equal(t, io.EOF, e)
+	assert.True(t, time.Since(n) < time.Second)
+
+	// The request context interrupts the back off
+	s = newStream()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	n = time.Now()
+	_, e = s.Next()
+	assert.Equal(t, context.Canceled, e)
+	assert.True(t, time.Since(n) < time.Second)
+	assert.Equal(t, 0, reconnects)
+}
+
+func TestRecordStream(t *testing.T) {
+	// Initialize
+	r := &response{originalResponse: &http.Response{Body: mockedIoReaderCloser([]byte("{\"a\":1}\n\n\x1e{\"a\":2}\r\n{\"a\":3}"))}}
+	s := r.Records()
+	var v struct {
+		A int `json:"a"`
+	}
+
+	// Assert
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, s.Next(&v))
+		assert.Equal(t, i, v.A)
+	}
+	assert.Equal(t, io.EOF, s.Next(&v))
+
+	// JSON sequence
+	r = &response{originalResponse: &http.Response{
+		Body:   mockedIoReaderCloser([]byte("\x1e{\n  \"a\": 1\n}\n\x1e\n\x1e{\"a\":\n2}\n")),
+		Header: http.Header{"Content-Type": []string{"application/json-seq"}},
+	}}
+	s = r.Records()
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, s.Next(&v))
+		assert.Equal(t, i, v.A)
+	}
+	assert.Equal(t, io.EOF, s.Next(&v))
+}
+
+func TestExecEventStream(t *testing.T) {
+	// Create server
+	done := make(chan bool)
+	defer close(done)
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.Header.Get("Last-Event-ID") == "" {
+			w.Write([]byte("retry: 1\nid: 1\ndata: first\n\n"))
+			w.(http.Flusher).Flush()
+			<-done
+		} else {
+			w.Write([]byte("id: 2\ndata: second\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	// Execute requests
+	respSet := NewGozzleFromConfiguration(Configuration{MaxSizeBody: 1024, BodyLimitMode: BodyLimitDiscard}).
+		Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, server.URL)))
+	defer respSet.Close()
+
+	// Get stream
+	s := respSet.GetResponse("test").Events().SetReconnect(1)
+	defer s.Close()
+
+	// Read first event
+	ev, e := s.Next()
+	assert.NoError(t, e)
+	assert.Equal(t, "first", ev.Data)
+
+	// Stop first stream
+	done <- true
+	ev, e = s.Next()
+	assert.NoError(t, e)
+	assert.Equal(t, "second", ev.Data)
+	_, e = s.Next()
+	assert.Equal(t, io.EOF, e)
+	assert.Equal(t, []string{"", "1"}, lastEventIDs)
+}
+
+func TestIsStreaming(t *testing.T) {
+	assert.False(t, isStreaming(&http.Response{}))
+	assert.True(t, isStreaming(&http.Response{Header: http.Header{"Content-Type": []string{"text/event-stream; charset=utf-8"}}}))
+	assert.False(t, isStreaming(&http.Response{Header: http.Header{"Content-Type": []string{"application/json"}}}))
+}
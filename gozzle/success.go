@@ -0,0 +1,55 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+// Variables
+var (
+	DefaultSuccessPolicy = StatusRange(200, 299)
+)
+
+// SuccessPolicy represents a function deciding whether a response is successful
+// Responses that are not successful get a *StatusError
+type SuccessPolicy func(resp Response) bool
+
+// StatusCodes creates a success policy accepting the provided status codes
+func StatusCodes(codes ...int) SuccessPolicy {
+	return func(resp Response) bool {
+		for _, c := range codes {
+			if resp.StatusCode() == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// StatusRange creates a success policy accepting status codes between min and max included
+func StatusRange(min, max int) SuccessPolicy {
+	return func(resp Response) bool {
+		return resp.StatusCode() >= min && resp.StatusCode() <= max
+	}
+}
+
+// AnyOf creates a success policy accepting responses accepted by at least one of the provided policies
+func AnyOf(ps ...SuccessPolicy) SuccessPolicy {
+	return func(resp Response) bool {
+		for _, p := range ps {
+			if p(resp) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// requestSuccessPolicy returns the request success policy, falling back on the gozzle one and then on the default one
+func (g gozzle) requestSuccessPolicy(req Request) SuccessPolicy {
+	if req.SuccessPolicy() != nil {
+		return req.SuccessPolicy()
+	} else if g.successPolicy != nil {
+		return g.successPolicy
+	}
+	return DefaultSuccessPolicy
+}
@@ -0,0 +1,55 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuccessPolicies(t *testing.T) {
+	// Initialize
+	r200 := &response{originalResponse: &http.Response{StatusCode: 200}}
+	r304 := &response{originalResponse: &http.Response{StatusCode: 304}}
+	r404 := &response{originalResponse: &http.Response{StatusCode: 404}}
+
+	// Assert
+	assert.True(t, DefaultSuccessPolicy(r200))
+	assert.False(t, DefaultSuccessPolicy(r304))
+	assert.True(t, StatusCodes(304, 404)(r304))
+	assert.False(t, StatusCodes(304)(r404))
+	assert.True(t, StatusRange(300, 399)(r304))
+	assert.False(t, StatusRange(300, 399)(r200))
+	assert.True(t, AnyOf(DefaultSuccessPolicy, StatusCodes(404))(r404))
+	assert.False(t, AnyOf(DefaultSuccessPolicy, StatusCodes(404))(r304))
+}
+
+func TestExecSuccessPolicy(t *testing.T) {
+	// Create server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(c)
+	}))
+	defer server.Close()
+
+	// Create request set
+	reqSet := NewRequestSet().
+		AddRequest(NewRequest("gozzle", MethodGet, server.URL).AddQuery("code", "304")).
+		AddRequest(NewRequest("request", MethodGet, server.URL).AddQuery("code", "404").SetSuccessPolicy(StatusCodes(404))).
+		AddRequest(NewRequest("error", MethodGet, server.URL).AddQuery("code", "500"))
+
+	// Execute requests
+	respSet := NewGozzle().SetSuccessPolicy(AnyOf(DefaultSuccessPolicy, StatusCodes(304))).Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.Len(t, respSet.GetResponse("gozzle").Errors(), 0)
+	assert.Len(t, respSet.GetResponse("request").Errors(), 0)
+	assert.Len(t, respSet.GetResponse("error").Errors(), 1)
+}
@@ -0,0 +1,258 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants
+const (
+	tlsPinPrefix = "sha256/"
+)
+
+// Variables
+var (
+	ErrInvalidCAFile      = errors.New("Invalid CA file")
+	ErrInvalidTLSVersion  = errors.New("Invalid TLS version")
+	ErrPinMismatch        = errors.New("No certificate matches the pinned public keys")
+	tlsCertificateRefresh = time.Second
+	tlsVersions           = map[string]uint16{"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+)
+
+// TLSConfiguration represents a JSON-friendly TLS configuration
+// CAFiles are PEM bundles trusted in addition to the system ones. Client certificates are reloaded from disk when
+// their files change so that they can be rotated without restarting. MinVersion is either "1.0", "1.1", "1.2" or
+// "1.3". Pins are base64-encoded SHA-256 hashes of subject public key infos, optionally prefixed with "sha256/": when
+// set, at least one certificate of the verified chains, or the leaf certificate if verification is disabled, must
+// match one of them. InsecureSkipVerify disables the verification of the server certificate and must only be used in
+// development.
+type TLSConfiguration struct {
+	CAFiles            []string         `json:"ca_files"`
+	Certificates       []TLSCertificate `json:"certificates"`
+	InsecureSkipVerify bool             `json:"insecure_skip_verify"`
+	MinVersion         string           `json:"min_version"`
+	Pins               []string         `json:"pins"`
+}
+
+// TLSCertificate represents a JSON-friendly client certificate
+type TLSCertificate struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// NewTLSConfig creates a tls.Config based on a TLS configuration
+func NewTLSConfig(c TLSConfiguration) (*tls.Config, error) {
+	// Initialize
+	t := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	// Min version
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrInvalidTLSVersion, c.MinVersion)
+		}
+		t.MinVersion = v
+	}
+
+	// CA files
+	if len(c.CAFiles) > 0 {
+		p, e := x509.SystemCertPool()
+		if e != nil {
+			p = x509.NewCertPool()
+		}
+		for _, f := range c.CAFiles {
+			b, e := ioutil.ReadFile(f)
+			if e != nil {
+				return nil, e
+			}
+			if !p.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("%w %s", ErrInvalidCAFile, f)
+			}
+		}
+		t.RootCAs = p
+	}
+
+	// Client certificates
+	if len(c.Certificates) > 0 {
+		var cs []*reloadableCertificate
+		for _, v := range c.Certificates {
+			r := &reloadableCertificate{certFile: v.CertFile, keyFile: v.KeyFile}
+			if _, e := r.certificate(); e != nil {
+				return nil, e
+			}
+			cs = append(cs, r)
+		}
+		t.GetClientCertificate = func(i *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return clientCertificate(cs, i)
+		}
+	}
+
+	// Pins
+	if len(c.Pins) > 0 {
+		pins := make(map[string]bool)
+		for _, p := range c.Pins {
+			pins[strings.TrimPrefix(p, tlsPinPrefix)] = true
+		}
+		insecure := c.InsecureSkipVerify
+		t.VerifyConnection = func(s tls.ConnectionState) error {
+			// Only the leaf can be trusted when the chain is not verified since the server can send any extra
+			// certificate
+			if insecure {
+				if len(s.PeerCertificates) > 0 && pins[PublicKeyPin(s.PeerCertificates[0])] {
+					return nil
+				}
+				return ErrPinMismatch
+			}
+
+			// Loop through verified chains
+			for _, v := range s.VerifiedChains {
+				for _, c := range v {
+					if pins[PublicKeyPin(c)] {
+						return nil
+					}
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+	return t, nil
+}
+
+// PublicKeyPin returns the base64-encoded SHA-256 hash of the subject public key info of the certificate
+func PublicKeyPin(c *x509.Certificate) string {
+	h := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// reloadableCertificate represents a client certificate reloaded when its files change
+type reloadableCertificate struct {
+	cert     *tls.Certificate
+	certFile string
+	checked  time.Time
+	keyFile  string
+	modTimes [2]time.Time
+	mutex    sync.Mutex
+}
+
+// certificate returns the certificate, reloading it if its files have changed
+// Files are checked at most once per second.
+func (r *reloadableCertificate) certificate() (*tls.Certificate, error) {
+	// Lock
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Certificate has been checked recently
+	if r.cert != nil && time.Since(r.checked) < tlsCertificateRefresh {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	// Get mod times
+	var ts [2]time.Time
+	for i, f := range []string{r.certFile, r.keyFile} {
+		s, e := os.Stat(f)
+		if e != nil {
+			if r.cert != nil {
+				// Keep the current certificate while files are being rotated
+				return r.cert, nil
+			}
+			return nil, e
+		}
+		ts[i] = s.ModTime()
+	}
+
+	// Files have not changed
+	if r.cert != nil && ts == r.modTimes {
+		return r.cert, nil
+	}
+
+	// Load certificate
+	c, e := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if e != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, e
+	}
+	r.cert = &c
+	r.modTimes = ts
+	return r.cert, nil
+}
+
+// clientCertificate returns the first client certificate accepted by the server
+func clientCertificate(cs []*reloadableCertificate, i *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	var first *tls.Certificate
+	for _, r := range cs {
+		c, e := r.certificate()
+		if e != nil {
+			return nil, e
+		}
+		if first == nil {
+			first = c
+		}
+		if i.SupportsCertificate(c) == nil {
+			return c, nil
+		}
+	}
+	return first, nil
+}
+
+// SetTLSConfiguration sets the TLS configuration of the transport
+// If the configuration is invalid, requests fail with the error until a valid configuration is set.
+func (g *gozzle) SetTLSConfiguration(c TLSConfiguration) Gozzle {
+	// Create tls config
+	g.tlsConfiguration = c
+	var t *tls.Config
+	if t, g.tlsErr = NewTLSConfig(c); g.tlsErr != nil {
+		return g
+	}
+
+	// Keep the protocols advertised by the transport such as HTTP/2
+	if g.transport.TLSClientConfig != nil {
+		t.NextProtos = g.transport.TLSClientConfig.NextProtos
+	}
+	g.transport.TLSClientConfig = t
+	return g
+}
+
+// TLSConfiguration returns the TLS configuration of the transport
+func (g *gozzle) TLSConfiguration() TLSConfiguration {
+	return g.tlsConfiguration
+}
+
+// Transport returns the transport owned by gozzle
+// It can be used to tune settings that are not exposed by gozzle, such as idle connections.
+func (g *gozzle) Transport() *http.Transport {
+	return g.transport
+}
+
+// TLSVersion returns the TLS version negotiated with the server, such as "TLS 1.3", or an empty string if the
+// connection was not encrypted
+func (r *response) TLSVersion() string {
+	if r.originalResponse == nil || r.originalResponse.TLS == nil {
+		return ""
+	}
+	return tls.VersionName(r.originalResponse.TLS.Version)
+}
+
+// PeerCertificates returns the certificates presented by the server, leaf first
+func (r *response) PeerCertificates() []*x509.Certificate {
+	if r.originalResponse == nil || r.originalResponse.TLS == nil {
+		return nil
+	}
+	return r.originalResponse.TLS.PeerCertificates
+}
@@ -0,0 +1,207 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+func newTestCertificate(t *testing.T, name string, serial int64, parent *testCertificate) *testCertificate {
+	// Create key
+	k, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, e)
+
+	// Create template
+	tpl := &x509.Certificate{
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+	}
+
+	// Sign
+	signer, signerKey := tpl, k
+	if parent == nil {
+		tpl.BasicConstraintsValid = true
+		tpl.IsCA = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, e := x509.CreateCertificate(rand.Reader, tpl, signer, &k.PublicKey, signerKey)
+	assert.NoError(t, e)
+	c, e := x509.ParseCertificate(der)
+	assert.NoError(t, e)
+	return &testCertificate{
+		cert: c,
+		key:  k,
+		tls:  tls.Certificate{Certificate: [][]byte{der}, Leaf: c, PrivateKey: k},
+	}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile, keyFile string) {
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	if keyFile != "" {
+		b, e := x509.MarshalECPrivateKey(c.key)
+		assert.NoError(t, e)
+		assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600))
+	}
+}
+
+func TestExecTLS(t *testing.T) {
+	// Initialize
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { tlsCertificateRefresh = d }(tlsCertificateRefresh)
+	tlsCertificateRefresh = 0
+	ca := newTestCertificate(t, "ca", 1, nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.write(t, caFile, "")
+	srv := newTestCertificate(t, "server", 2, ca)
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	newTestCertificate(t, "client-1", 3, ca).write(t, certFile, keyFile)
+
+	// Create server
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	s.TLS = &tls.Config{
+		Certificates: []tls.Certificate{srv.tls},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+	s.StartTLS()
+	defer s.Close()
+	exec := func(g Gozzle) Response {
+		return g.Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, s.URL))).GetResponse("test")
+	}
+
+	// Unknown authority
+	g := NewGozzle()
+	assert.Len(t, exec(g).Errors(), 1)
+
+	// Insecure
+	g.SetTLSConfiguration(TLSConfiguration{InsecureSkipVerify: true})
+	resp := exec(g)
+	assert.Empty(t, resp.Errors())
+	assert.Equal(t, "TLS 1.3", resp.TLSVersion())
+	assert.Equal(t, "server", resp.PeerCertificates()[0].Subject.CommonName)
+
+	// CA file and client certificate
+	g.SetTLSConfiguration(TLSConfiguration{
+		CAFiles:      []string{caFile},
+		Certificates: []TLSCertificate{{CertFile: certFile, KeyFile: keyFile}},
+		MinVersion:   "1.2",
+	})
+	b, e := exec(g).Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "client-1", string(b))
+
+	// Rotate client certificate
+	newTestCertificate(t, "client-2", 4, ca).write(t, certFile, keyFile)
+	m := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, m, m))
+	assert.NoError(t, os.Chtimes(keyFile, m, m))
+	b, e = exec(g).Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "client-2", string(b))
+
+	// Pins
+	g.SetTLSConfiguration(TLSConfiguration{CAFiles: []string{caFile}, Pins: []string{"sha256/" + PublicKeyPin(ca.cert)}})
+	resp = exec(g)
+	assert.Empty(t, resp.Errors())
+	g.SetTLSConfiguration(TLSConfiguration{CAFiles: []string{caFile}, Pins: []string{PublicKeyPin(srv.cert)}})
+	assert.Empty(t, exec(g).Errors())
+	g.SetTLSConfiguration(TLSConfiguration{InsecureSkipVerify: true, Pins: []string{PublicKeyPin(ca.cert)}})
+	resp = exec(g)
+	assert.Len(t, resp.Errors(), 1)
+	assert.True(t, errors.Is(resp.Errors()[0], ErrPinMismatch))
+	g.SetTLSConfiguration(TLSConfiguration{InsecureSkipVerify: true, Pins: []string{PublicKeyPin(srv.cert)}})
+	assert.Empty(t, exec(g).Errors())
+
+	// Invalid configuration
+	g.SetTLSConfiguration(TLSConfiguration{MinVersion: "2.0"})
+	resp = exec(g)
+	assert.Len(t, resp.Errors(), 1)
+	assert.True(t, errors.Is(resp.Errors()[0], ErrInvalidTLSVersion))
+	g.SetTLSConfiguration(TLSConfiguration{CAFiles: []string{keyFile}})
+	assert.True(t, errors.Is(exec(g).Errors()[0], ErrInvalidCAFile))
+	g.SetTLSConfiguration(TLSConfiguration{InsecureSkipVerify: true})
+	assert.Empty(t, exec(g).Errors())
+}
+
+func TestExecTLSPinExtraCertificate(t *testing.T) {
+	// Initialize
+	dir, e := ioutil.TempDir("", "gozzle")
+	assert.NoError(t, e)
+	defer os.RemoveAll(dir)
+	pinned := newTestCertificate(t, "pinned", 1, nil)
+	attacker := newTestCertificate(t, "attacker", 2, nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	attacker.write(t, caFile, "")
+	leaf := newTestCertificate(t, "leaf", 3, attacker)
+
+	// Create server sending the pinned certificate as an extra certificate that is not part of its chain
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.cert.Raw, pinned.cert.Raw},
+		PrivateKey:  leaf.key,
+	}}}
+	s.StartTLS()
+	defer s.Close()
+	exec := func(c TLSConfiguration) Response {
+		return NewGozzle().SetTLSConfiguration(c).Exec(NewRequestSet().AddRequest(NewRequest("test", MethodGet, s.URL))).GetResponse("test")
+	}
+
+	// Assert
+	for _, c := range []TLSConfiguration{
+		{CAFiles: []string{caFile}, Pins: []string{PublicKeyPin(pinned.cert)}},
+		{InsecureSkipVerify: true, Pins: []string{PublicKeyPin(pinned.cert)}},
+	} {
+		resp := exec(c)
+		assert.Len(t, resp.Errors(), 1)
+		assert.True(t, errors.Is(resp.Errors()[0], ErrPinMismatch))
+	}
+	assert.Empty(t, exec(TLSConfiguration{CAFiles: []string{caFile}, Pins: []string{PublicKeyPin(attacker.cert)}}).Errors())
+}
+
+func TestNewGozzleFromConfigurationTLS(t *testing.T) {
+	assert.NotNil(t, NewGozzleFromConfiguration(Configuration{}).Transport())
+	g := NewGozzleFromConfiguration(Configuration{TLS: &TLSConfiguration{MinVersion: "1.3"}})
+	assert.Equal(t, "1.3", g.TLSConfiguration().MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS13), g.Transport().TLSClientConfig.MinVersion)
+	assert.Contains(t, g.Transport().TLSClientConfig.NextProtos, "h2")
+}
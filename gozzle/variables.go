@@ -0,0 +1,274 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Variables
+var (
+	ErrUndefinedVariable = errors.New("Undefined variable")
+	ErrVariableCycle     = errors.New("Variable cycle")
+	regexpTemplate       = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+)
+
+// variables represents the variables extracted during the execution of a request set
+type variables struct {
+	m     map[string]string
+	mutex sync.RWMutex
+}
+
+func newVariables() *variables {
+	return &variables{m: make(map[string]string)}
+}
+
+func (vs *variables) get(name string) (v string, ok bool) {
+	vs.mutex.RLock()
+	defer vs.mutex.RUnlock()
+	v, ok = vs.m[name]
+	return
+}
+
+func (vs *variables) set(name, v string) {
+	vs.mutex.Lock()
+	defer vs.mutex.Unlock()
+	vs.m[name] = v
+}
+
+// execution represents the dependencies between the requests of a request set created by their variables
+// Requests referencing {{name}} in their path, headers, query or body wait for the requests extracting name to be
+// done. References to variables no request extracts are left as is.
+type execution struct {
+	cyclic    map[string]bool
+	deps      map[string][]string
+	done      map[string]chan struct{}
+	producers map[string][]string
+	variables *variables
+}
+
+// newExecution plans the execution of the request set or returns nil if no request extracts variables
+func newExecution(reqSet RequestSet) *execution {
+	// Get producers
+	x := &execution{
+		cyclic:    make(map[string]bool),
+		deps:      make(map[string][]string),
+		done:      make(map[string]chan struct{}),
+		producers: make(map[string][]string),
+		variables: newVariables(),
+	}
+	names := reqSet.Names()
+	for _, name := range names {
+		for _, e := range reqSet.GetRequest(name).Extractors() {
+			x.producers[e.Variable()] = append(x.producers[e.Variable()], name)
+		}
+	}
+
+	// No variables
+	if len(x.producers) == 0 {
+		return nil
+	}
+
+	// Get dependencies
+	for _, name := range names {
+		x.done[name] = make(chan struct{})
+		deps := make(map[string]bool)
+		for _, v := range x.references(reqSet.GetRequest(name)) {
+			for _, p := range x.producers[v] {
+				if !deps[p] {
+					deps[p] = true
+					x.deps[name] = append(x.deps[name], p)
+				}
+			}
+		}
+	}
+
+	// Detect cycles
+	for _, name := range names {
+		if x.reaches(name, name, make(map[string]bool)) {
+			x.cyclic[name] = true
+		}
+	}
+	return x
+}
+
+// reaches checks whether the target request is a dependency of the request, directly or not
+func (x *execution) reaches(name, target string, visited map[string]bool) bool {
+	for _, d := range x.deps[name] {
+		if d == target {
+			return true
+		}
+		if visited[d] {
+			continue
+		}
+		visited[d] = true
+		if x.reaches(d, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// references returns the extracted variables referenced by the request
+func (x *execution) references(req Request) (vs []string) {
+	// Get templates
+	ts := []string{req.Path()}
+	for _, v := range req.Headers() {
+		ts = append(ts, v)
+	}
+	for k, v := range req.Query() {
+		ts = append(ts, k, v)
+	}
+	if b, _, ok := templateBody(req); ok {
+		ts = append(ts, string(b))
+	}
+
+	// Loop through templates
+	m := make(map[string]bool)
+	for _, t := range ts {
+		for _, s := range regexpTemplate.FindAllStringSubmatch(t, -1) {
+			if _, ok := x.producers[s[1]]; ok && !m[s[1]] {
+				m[s[1]] = true
+				vs = append(vs, s[1])
+			}
+		}
+	}
+	return
+}
+
+// waits checks whether the request waits for variables
+func (x *execution) waits(name string) bool {
+	return x != nil && len(x.deps[name]) > 0
+}
+
+// finish signals the request is done
+func (x *execution) finish(name string) {
+	if x == nil {
+		return
+	}
+	if c, ok := x.done[name]; ok {
+		close(c)
+	}
+}
+
+// prepare waits for the dependencies of the request and returns a copy of the request whose templates are rendered
+func (x *execution) prepare(req Request) (Request, error) {
+	// No dependencies
+	if !x.waits(req.Name()) {
+		return req, nil
+	}
+
+	// Cycle
+	if x.cyclic[req.Name()] {
+		return req, ErrVariableCycle
+	}
+
+	// Wait for dependencies
+	for _, d := range x.deps[req.Name()] {
+		<-x.done[d]
+	}
+
+	// Render
+	return x.render(req)
+}
+
+// all returns a copy of the variables
+func (x *execution) all() map[string]string {
+	m := make(map[string]string)
+	if x == nil {
+		return m
+	}
+	x.variables.mutex.RLock()
+	defer x.variables.mutex.RUnlock()
+	for k, v := range x.variables.m {
+		m[k] = v
+	}
+	return m
+}
+
+func (x *execution) vars() *variables {
+	if x == nil {
+		return nil
+	}
+	return x.variables
+}
+
+func (x *execution) render(req Request) (Request, error) {
+	// Initialize
+	var err error
+	fn := func(s string, escape func(string) string) string {
+		return regexpTemplate.ReplaceAllStringFunc(s, func(m string) string {
+			name := regexpTemplate.FindStringSubmatch(m)[1]
+			if _, ok := x.producers[name]; !ok {
+				return m
+			}
+			v, ok := x.variables.get(name)
+			if !ok {
+				if err == nil {
+					err = fmt.Errorf("%w %s", ErrUndefinedVariable, name)
+				}
+				return m
+			}
+			return escape(v)
+		})
+	}
+	raw := func(s string) string { return s }
+
+	// Path and headers
+	c := req.Clone()
+	c.SetPath(fn(c.Path(), raw))
+	for k, v := range c.Headers() {
+		c.AddHeader(k, fn(v, raw))
+	}
+
+	// Query
+	q := make(map[string]string)
+	for k, v := range c.Query() {
+		q[fn(k, raw)] = fn(v, raw)
+	}
+	c.SetQuery(q)
+
+	// Body
+	if b, escape, ok := templateBody(c); ok {
+		c.SetBody(RawBody(fn(string(b), escape)))
+	}
+	return c, err
+}
+
+// templateBody returns the encoded body of the request and how to escape the values inserted in it
+func templateBody(req Request) ([]byte, func(string) string, bool) {
+	// No body or body reader
+	if req.BodyReader() != nil || req.Body() == nil {
+		return nil, nil, false
+	}
+
+	// Raw body
+	if b, ok := req.Body().(RawBody); ok {
+		return b, func(s string) string { return s }, true
+	}
+
+	// Encode body
+	b, e := encodeBody(req)
+	if e != nil {
+		return nil, nil, false
+	}
+	if isXMLBody(req) {
+		return b, func(s string) string {
+			buf := &bytes.Buffer{}
+			xml.EscapeText(buf, []byte(s))
+			return buf.String()
+		}, true
+	}
+	return b, func(s string) string {
+		j, _ := json.Marshal(s)
+		return string(j[1 : len(j)-1])
+	}, true
+}
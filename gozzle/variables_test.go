@@ -0,0 +1,118 @@
+// Copyright 2015, Quentin RENARD. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gozzle
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecVariables(t *testing.T) {
+	// Initialize
+	var m sync.Mutex
+	var bodies []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Session", "session")
+			w.Write([]byte(`{"token":"to\"ken","user":{"id":42}}`))
+		case "/users/42":
+			b, _ := ioutil.ReadAll(r.Body)
+			m.Lock()
+			bodies = append(bodies, string(b))
+			m.Unlock()
+			w.Write([]byte(r.Header.Get("Authorization") + " " + r.URL.Query().Get("session") + " " + r.URL.Query().Get("other")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("login", MethodPost, s.URL+"/login").AddExtractor(
+		ExtractJSONPath("token", "$.token"),
+		ExtractJSONPath("user_id", "$.user.id"),
+		ExtractHeader("session", "X-Session"),
+	))
+	user := NewRequest("user", MethodPost, s.URL+"/users/{{ user_id }}").
+		AddHeader("Authorization", "Bearer {{token}}").
+		AddQuery("session", "{{session}}").
+		AddQuery("other", "{{other}}").
+		SetBody(map[string]string{"token": "{{token}}"})
+	reqSet.AddRequest(user)
+	reqSet.AddRequest(NewRequest("raw", MethodPost, s.URL+"/users/{{user_id}}").SetBody(RawBody("token={{token}}")))
+
+	// Execute
+	respSet := NewGozzle().SetConcurrency(1).Exec(reqSet)
+	defer respSet.Close()
+
+	// Assert
+	assert.Equal(t, map[string]string{"session": "session", "token": "to\"ken", "user_id": "42"}, respSet.Variables())
+	assert.Empty(t, respSet.GetResponse("user").Errors())
+	b, e := respSet.GetResponse("user").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "Bearer to\"ken session {{other}}", string(b))
+	assert.ElementsMatch(t, []string{`{"token":"to\"ken"}`, `token=to"ken`}, bodies)
+	assert.Equal(t, s.URL+"/users/{{ user_id }}", user.Path())
+	assert.Equal(t, "Bearer {{token}}", user.GetHeader("Authorization"))
+}
+
+func TestExecVariablesErrors(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+	reqSet := NewRequestSet()
+	reqSet.AddRequest(NewRequest("a", MethodGet, s.URL+"/{{b}}").AddExtractor(ExtractJSONPath("a", "$.a")))
+	reqSet.AddRequest(NewRequest("b", MethodGet, s.URL+"/{{a}}").AddExtractor(ExtractJSONPath("b", "$.b")))
+	reqSet.AddRequest(NewRequest("c", MethodGet, s.URL+"/{{a}}"))
+	reqSet.AddRequest(NewRequest("d", MethodGet, s.URL).AddExtractor(ExtractJSONPath("d", "$.d")))
+	reqSet.AddRequest(NewRequest("e", MethodGet, s.URL+"/{{d}}"))
+	reqSet.AddRequest(NewRequest("f", MethodGet, s.URL+"/{{f}}").AddExtractor(ExtractJSONPath("f", "$.f")))
+
+	// Execute
+	respSet := NewGozzle().Exec(reqSet)
+
+	// Assert
+	for _, name := range []string{"a", "b", "f"} {
+		assert.Equal(t, []error{ErrVariableCycle}, respSet.GetResponse(name).Errors(), name)
+	}
+	for name, v := range map[string]string{"c": "a", "e": "d"} {
+		errs := respSet.GetResponse(name).Errors()
+		assert.Len(t, errs, 1, name)
+		assert.True(t, errors.Is(errs[0], ErrUndefinedVariable), name)
+		assert.EqualError(t, errs[0], "Undefined variable "+v, name)
+	}
+	errs := respSet.GetResponse("d").Errors()
+	assert.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "Extracting variable d failed: JSON path not found")
+	assert.Empty(t, respSet.Variables())
+}
+
+func TestExecVariablesOrder(t *testing.T) {
+	// Initialize
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer s.Close()
+	reqSet := NewOrderedRequestSet()
+	reqSet.AddRequest(NewRequest("consumer", MethodGet, s.URL+"{{path}}/consumer"))
+	reqSet.AddRequest(NewRequest("producer", MethodGet, s.URL+"/producer").AddExtractor(ExtractRegexp("path", ".+")))
+
+	// Execute
+	respSet := NewGozzle().SetConcurrency(1).Exec(reqSet)
+
+	// Assert
+	b, e := respSet.GetResponse("consumer").Body()
+	assert.NoError(t, e)
+	assert.Equal(t, "/producer/consumer", string(b))
+	assert.Equal(t, []string{"consumer", "producer"}, respSet.Names())
+}